@@ -1,17 +1,32 @@
 package api
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+var errAccountExists = errors.New("account already exists for this currency")
+
+var errAccountNameTaken = errors.New("owner already has an account with this name")
+
+var errInvalidDateRange = errors.New("from must not be after to")
+
+var errCurrencyRequired = errors.New("currency is required")
+
 type createAccountRequest struct {
 	Owner    string `json:"owner" binding:"required"`
-	Currency string `json:"currency" binding:"required,oneof=USD EUR"`
+	//Currency may be left out when USE_DEFAULT_CURRENCY is on, the account then gets DEFAULT_CURRENCY
+	Currency string `json:"currency" binding:"omitempty,currency"`
+	//optional friendly name, unique per owner
+	Name string `json:"name" binding:"max=64"`
+	//when set, the account is opened with this balance and a matching opening entry
+	InitialBalance int64 `json:"initial_balance" binding:"min=0"`
 }
 
 func (server *Server) createAccount(ctx *gin.Context) {
@@ -20,49 +35,183 @@ func (server *Server) createAccount(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errResponse(err))
 		return
 	}
+	arg, err := server.createAccountParams(req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	result, err := server.store.CreateAccountTx(ctx, arg)
+	if err != nil {
+		respondCreateAccountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
 
-	arg := db.CreateAccountParams{
+//createAccountParams turns a validated request into CreateAccountTx params, filling in the default currency
+func (server *Server) createAccountParams(req createAccountRequest) (db.CreateAccountTxParams, error) {
+	if req.Currency == "" {
+		if !server.config.UseDefaultCurrency {
+			return db.CreateAccountTxParams{}, errCurrencyRequired
+		}
+		//Validate has checked that it's supported
+		req.Currency = server.config.DefaultCurrency
+	}
+	return db.CreateAccountTxParams{
 		Owner: req.Owner,
 		Currency: req.Currency,
-		Balance: 0,
+		Name: pgtype.Text{String: req.Name, Valid: req.Name != ""},
+		InitialBalance: req.InitialBalance,
+	}, nil
+}
+
+//respondCreateAccountError writes the response for a failed CreateAccountTx or CreateAccountsTx
+//for a batch, the message says which account failed
+func respondCreateAccountError(ctx *gin.Context, err error) {
+	if handleContextError(ctx, err) {
+		return
+	}
+	status, cause := http.StatusInternalServerError, err
+	switch {
+	case db.IsConstraintViolation(err, db.OwnerNameKey):
+		status, cause = http.StatusConflict, errAccountNameTaken
+	case db.IsConstraintViolation(err, db.OwnerCurrencyKey):
+		status, cause = http.StatusConflict, errAccountExists
+	//account_number_key is retried by the store, if it still fails it's a 500 like any other unique violation
+	}
+	var batchErr *db.AccountBatchError
+	if cause != err && errors.As(err, &batchErr) {
+		cause = fmt.Errorf("account %d: %w", batchErr.Index, cause)
 	}
+	ctx.JSON(status, errResponse(cause))
+}
+
+type createAccountsBatchRequest struct {
+	Accounts []createAccountRequest `json:"accounts" binding:"required,min=1,max=100,dive"`
+}
 
-	account, err := server.store.CreateAccount(ctx, arg)
+type createAccountsBatchResponse struct {
+	Accounts []db.CreateAccountTxResult `json:"accounts"`
+}
+
+//createAccountsBatch opens several accounts in one transaction, for onboarding a client with many of them
+//every item is validated like POST /accounts before anything is written, and if one account fails none are created
+func (server *Server) createAccountsBatch(ctx *gin.Context) {
+	var req createAccountsBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	args := make([]db.CreateAccountTxParams, 0, len(req.Accounts))
+	for i, item := range req.Accounts {
+		arg, err := server.createAccountParams(item)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errResponse(fmt.Errorf("account %d: %w", i, err)))
+			return
+		}
+		args = append(args, arg)
+	}
+
+	results, err := server.store.CreateAccountsTx(ctx, args)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		respondCreateAccountError(ctx, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, account)
+	ctx.JSON(http.StatusOK, createAccountsBatchResponse{Accounts: results})
 }
 
 type getAccountRequest struct {
 	ID int64 `uri:"id" binding:"required,min=1"`
 }
 
+type getAccountQuery struct {
+	//comma separated account fields to return, all of them when empty
+	Fields string `form:"fields"`
+}
+
+//accountFields are the fields ?fields= may ask for, the json names of db.Account
+var accountFields = map[string]bool{
+	"id": true,
+	"owner": true,
+	"balance": true,
+	"currency": true,
+	"created_at": true,
+	"held_balance": true,
+	"name": true,
+	"updated_at": true,
+	"account_number": true,
+	"metadata": true,
+	"formatted_balance": true,
+}
+
 func (server *Server) getAccount(ctx *gin.Context) {
 	var req getAccountRequest
 	if err := ctx.ShouldBindUri(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errResponse(err))
 		return
 	}
+	var query getAccountQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	fields, err := parseFields(query.Fields, accountFields)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
 
 	account, err := server.store.GetAccount(ctx, req.ID)
 	fmt.Print("run this")
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errResponse(err))
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
 			return 
 		}
 		ctx.JSON(http.StatusInternalServerError, errResponse(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, account)
+	body, err := selectFields(account, fields)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	//every change to an account bumps updated_at, so an unchanged body means an unchanged account
+	//a projection gets its own ETag, since its body differs from the full account's
+	respondWithETag(ctx, body)
+}
+
+type getAccountByNumberRequest struct {
+	AccountNumber string `uri:"number" binding:"required,account_number"`
+}
+
+//getAccountByNumber looks an account up by its public number, the same way getAccount does by id
+func (server *Server) getAccountByNumber(ctx *gin.Context) {
+	var req getAccountByNumberRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, ok := server.getAccountByNumberOrRespond(ctx, req.AccountNumber)
+	if !ok {
+		return
+	}
+	respondWithETag(ctx, account)
 }
 
 type listAccountRequest struct {
 	PageID int32 `form:"page_id" binding:"required,min=1"`
-	PageSize int32 `form:"page_size" binding:"required,max=20"`	
+	PageSize int32 `form:"page_size" binding:"required,min=1"`	
+	Sort string `form:"sort" binding:"omitempty,oneof=id created_at"`
+	//optional filters, an empty value matches every account
+	Owner string `form:"owner"`
+	Currency string `form:"currency" binding:"omitempty,currency"`
 }
 
 func (server *Server)listAccount(ctx *gin.Context) {
@@ -71,17 +220,327 @@ func (server *Server)listAccount(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errResponse(err))
 		return
 	}
+	req.PageSize = server.clampPageSize(ctx, req.PageSize)
+
+	owner := pgtype.Text{String: req.Owner, Valid: req.Owner != ""}
+	currency := pgtype.Text{String: req.Currency, Valid: req.Currency != ""}
 
 	arg := db.ListAccountsParams{
+		Owner: owner,
+		Currency: currency,
+		SortBy: req.Sort,
 		Limit: req.PageSize,
 		Offset: (req.PageID - 1) * req.PageSize,
 	}
 	accounts, err := server.store.ListAccounts(ctx, arg)
 	fmt.Print("run this")
 	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, errResponse(err))
 		return
 	}
 
+	total, err := server.store.CountAccounts(ctx, db.CountAccountsParams{
+		Owner: owner,
+		Currency: currency,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	setPaginationHeaders(ctx, req.PageID, req.PageSize, total)
+
 	ctx.JSON(http.StatusOK, accounts)
-}
\ No newline at end of file
+}
+
+//maxBatchAccounts caps how many ids one GET /accounts/batch may ask for
+//POST /accounts/batch has the same cap in its binding
+const maxBatchAccounts = 100
+
+type getAccountsBatchRequest struct {
+	//Owner is an optional filter, accounts of other owners are left out
+	//it's not authorization: ownership isn't enforced until the server has authentication
+	Owner string `form:"owner"`
+	//IDs is a comma separated list of account ids
+	IDs string `form:"ids" binding:"required"`
+}
+
+type getAccountsBatchResponse struct {
+	Accounts []db.Account `json:"accounts"`
+}
+
+//getAccountsBatch returns the accounts among the requested ids in one query, ordered by id
+//ids that don't exist, or don't match the owner filter, are silently dropped
+func (server *Server) getAccountsBatch(ctx *gin.Context) {
+	var req getAccountsBatchRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	ids, err := parseIDs(req.IDs, maxBatchAccounts)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	accounts, err := server.store.ListAccountsByIDs(ctx, db.ListAccountsByIDsParams{
+		Ids: ids,
+		Owner: pgtype.Text{String: req.Owner, Valid: req.Owner != ""},
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, getAccountsBatchResponse{Accounts: accounts})
+}
+
+type updateAccountNameURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type updateAccountNameRequest struct {
+	//an empty name removes it
+	Name string `json:"name" binding:"max=64"`
+}
+
+//updateAccountName sets or clears the friendly name of an account
+func (server *Server) updateAccountName(ctx *gin.Context) {
+	var uri updateAccountNameURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req updateAccountNameRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, err := server.store.UpdateAccountName(ctx, db.UpdateAccountNameParams{
+		ID: uri.ID,
+		Name: pgtype.Text{String: req.Name, Valid: req.Name != ""},
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, db.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return
+		case db.IsConstraintViolation(err, db.OwnerNameKey):
+			ctx.JSON(http.StatusConflict, errResponse(errAccountNameTaken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
+
+type updateAccountCurrencyURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type updateAccountCurrencyRequest struct {
+	Currency string `json:"currency" binding:"required,currency"`
+}
+
+var errAccountInUse = errors.New("currency can only be changed on an account with zero balance and no transfers")
+
+//updateAccountCurrency fixes the currency of an account that has never held money
+func (server *Server) updateAccountCurrency(ctx *gin.Context) {
+	var uri updateAccountCurrencyURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req updateAccountCurrencyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	if _, ok := server.getAccountOrRespond(ctx, uri.ID); !ok {
+		return
+	}
+
+	//the zero balance / no transfers guard is part of the UPDATE, so no row means the guard failed
+	account, err := server.store.UpdateAccountCurrency(ctx, db.UpdateAccountCurrencyParams{
+		ID: uri.ID,
+		Currency: req.Currency,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, db.ErrRecordNotFound):
+			ctx.JSON(http.StatusConflict, errResponse(errAccountInUse))
+			return
+		case db.IsConstraintViolation(err, db.OwnerCurrencyKey):
+			ctx.JSON(http.StatusConflict, errResponse(errAccountExists))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
+
+//dateRange is an optional, inclusive created_at filter given as RFC3339 query params
+//a missing bound leaves that side of the range open
+type dateRange struct {
+	From time.Time `form:"from"`
+	To time.Time `form:"to"`
+}
+
+func (r dateRange) validate() error {
+	if !r.From.IsZero() && !r.To.IsZero() && r.From.After(r.To) {
+		return errInvalidDateRange
+	}
+	return nil
+}
+
+func (r dateRange) fromTime() pgtype.Timestamp {
+	return pgtype.Timestamp{Time: r.From.UTC(), Valid: !r.From.IsZero()}
+}
+
+func (r dateRange) toTime() pgtype.Timestamp {
+	return pgtype.Timestamp{Time: r.To.UTC(), Valid: !r.To.IsZero()}
+}
+
+//closed fills in the missing bounds: to defaults to now and from to period before to
+//the queries then always get a closed range, which the (account_id, created_at) indexes can serve
+func (r dateRange) closed(now time.Time, period time.Duration) (time.Time, time.Time) {
+	to := r.To
+	if to.IsZero() {
+		to = now
+	}
+	from := r.From
+	if from.IsZero() {
+		from = to.Add(-period)
+	}
+	return from.UTC(), to.UTC()
+}
+
+type accountBalancesURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type accountBalancesResponse struct {
+	AccountID int64 `json:"account_id"`
+	Currency string `json:"currency"`
+	//LedgerBalance is everything booked to the account, the balance column
+	LedgerBalance int64 `json:"ledger_balance"`
+	//HeldBalance is reserved by outstanding holds, pending transfers not yet captured or voided
+	HeldBalance int64 `json:"held_balance"`
+	//AvailableBalance is what can be spent or held now, ledger minus held
+	AvailableBalance int64 `json:"available_balance"`
+}
+
+//getAccountBalances returns the account's ledger and available balances
+//both come from the same row, so they are consistent with each other
+//any account's balances can be read, ownership isn't enforced until the server has authentication
+func (server *Server) getAccountBalances(ctx *gin.Context) {
+	var uri accountBalancesURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, ok := server.getAccountOrRespond(ctx, uri.ID)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, accountBalancesResponse{
+		AccountID: account.ID,
+		Currency: account.Currency,
+		LedgerBalance: account.Balance,
+		HeldBalance: account.HeldBalance,
+		AvailableBalance: account.AvailableBalance(),
+	})
+}
+
+type accountSummaryRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type accountSummaryResponse struct {
+	AccountID int64 `json:"account_id"`
+	Balance int64 `json:"balance"`
+	Currency string `json:"currency"`
+	TotalDeposited int64 `json:"total_deposited"`
+	TotalWithdrawn int64 `json:"total_withdrawn"`
+	TransfersSent int64 `json:"transfers_sent"`
+	TransfersReceived int64 `json:"transfers_received"`
+}
+
+//getAccountSummary returns money in/out and transfer counts for an account, all-time unless from/to are given
+func (server *Server) getAccountSummary(ctx *gin.Context) {
+	var req accountSummaryRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var period dateRange
+	if err := ctx.ShouldBindQuery(&period); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if err := period.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, ok := server.getAccountOrRespond(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	totals, err := server.store.GetEntryTotals(ctx, db.GetEntryTotalsParams{
+		AccountID: account.ID,
+		FromTime: period.fromTime(),
+		ToTime: period.toTime(),
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	transfers, err := server.store.CountAccountTransfers(ctx, db.CountAccountTransfersParams{
+		AccountID: account.ID,
+		FromTime: period.fromTime(),
+		ToTime: period.toTime(),
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, accountSummaryResponse{
+		AccountID: account.ID,
+		Balance: account.Balance,
+		Currency: account.Currency,
+		TotalDeposited: totals.TotalDeposited,
+		TotalWithdrawn: totals.TotalWithdrawn,
+		TransfersSent: transfers.Sent,
+		TransfersReceived: transfers.Received,
+	})
+}
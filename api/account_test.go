@@ -0,0 +1,1006 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/db/testutil"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCreateAccountAPI(t *testing.T) {
+	account := randomAccount("USD")
+	entry := db.Entry{ID: 1, AccountID: account.ID, Amount: account.Balance}
+
+	testCases := []struct {
+		name string
+		body gin.H
+		//defaultCurrency, when set, turns USE_DEFAULT_CURRENCY on with it
+		defaultCurrency string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": account.Currency,
+				"initial_balance": account.Balance,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateAccountTxParams{
+					Owner: account.Owner,
+					Currency: account.Currency,
+					InitialBalance: account.Balance,
+				}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Eq(arg)).Times(1).
+					Return(db.CreateAccountTxResult{Account: account, OpeningEntry: &entry}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var result db.CreateAccountTxResult
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+				require.Equal(t, account, result.Account)
+				require.Equal(t, &entry, result.OpeningEntry)
+			},
+		},
+		{
+			name: "NegativeInitialBalance",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": account.Currency,
+				"initial_balance": -1,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "MissingCurrencyStrict",
+			body: gin.H{
+				"owner": account.Owner,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+				require.Contains(t, recorder.Body.String(), errCurrencyRequired.Error())
+			},
+		},
+		{
+			name: "MissingCurrencyDefault",
+			body: gin.H{
+				"owner": account.Owner,
+			},
+			defaultCurrency: util.EUR,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateAccountTxParams{
+					Owner: account.Owner,
+					Currency: util.EUR,
+				}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Eq(arg)).Times(1).
+					Return(db.CreateAccountTxResult{Account: account}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "ExplicitCurrencyOverDefault",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": util.JPY,
+			},
+			defaultCurrency: util.EUR,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateAccountTxParams{
+					Owner: account.Owner,
+					Currency: util.JPY,
+				}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Eq(arg)).Times(1).
+					Return(db.CreateAccountTxResult{Account: account}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "OwnerHasCurrency",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": account.Currency,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				err := &pgconn.PgError{Code: db.UniqueViolation, ConstraintName: db.OwnerCurrencyKey}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(1).Return(db.CreateAccountTxResult{}, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountExists)
+			},
+		},
+		{
+			name: "AccountNumberTaken",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": account.Currency,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				//the store has already drawn again, it's not the client's account that exists
+				err := &pgconn.PgError{Code: db.UniqueViolation, ConstraintName: db.AccountNumberKey}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(1).Return(db.CreateAccountTxResult{}, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireBodyCode(t, recorder, codeInternal)
+			},
+		},
+		{
+			name: "UnsupportedCurrencyWithDefault",
+			body: gin.H{
+				"owner": account.Owner,
+				"currency": "GBP",
+			},
+			defaultCurrency: util.EUR,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			if tc.defaultCurrency != "" {
+				server = NewServer(util.Config{
+					EnableTransfers: true,
+					DefaultCurrency: tc.defaultCurrency,
+					UseDefaultCurrency: true,
+				}, store)
+			}
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/accounts", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAccountAPI(t *testing.T) {
+	account := randomAccount("USD")
+
+	//the first read hands out the ETag the later requests revalidate with
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	etag := recorder.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	changed := account
+	changed.Balance++
+
+	testCases := []struct {
+		name string
+		ifNoneMatch string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "NotModified",
+			ifNoneMatch: etag,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotModified, recorder.Code)
+				require.Equal(t, etag, recorder.Header().Get("ETag"))
+				require.Empty(t, recorder.Body.Bytes())
+			},
+		},
+		{
+			name: "Changed",
+			ifNoneMatch: etag,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(changed, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotEqual(t, etag, recorder.Header().Get("ETag"))
+
+				var got db.Account
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, changed, got)
+			},
+		},
+		{
+			name: "NotFound",
+			ifNoneMatch: etag,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Empty(t, recorder.Header().Get("ETag"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+			require.NoError(t, err)
+			request.Header.Set("If-None-Match", tc.ifNoneMatch)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAccountFieldsAPI(t *testing.T) {
+	account := randomAccount("USD")
+
+	testCases := []struct {
+		name string
+		fields string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "BalanceCurrency",
+			fields: "balance, currency",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, map[string]any{"balance": float64(account.Balance), "currency": account.Currency}, got)
+			},
+		},
+		{
+			name: "FormattedBalance",
+			fields: "balance,formatted_balance",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, map[string]any{
+					"balance": float64(account.Balance),
+					"formatted_balance": util.FormatAmountGrouped(account.Balance, account.Currency),
+				}, got)
+			},
+		},
+		{
+			name: "AllFields",
+			fields: "",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				//every field of the account is on the allow-list
+				var got map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Len(t, got, len(accountFields))
+				for field := range got {
+					require.True(t, accountFields[field], field)
+				}
+			},
+		},
+		{
+			name: "UnknownField",
+			fields: "balance,password",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), codeInvalidRequest)
+			},
+		},
+		{
+			name: "EmptyField",
+			fields: "balance,",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d?fields=%s", account.ID, url.QueryEscape(tc.fields))
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAccountsBatchAPI(t *testing.T) {
+	account1 := randomAccount("USD")
+	account2 := randomAccount("EUR")
+	account2.Owner = account1.Owner
+
+	testCases := []struct {
+		name string
+		query string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: fmt.Sprintf("owner=%s&ids=%d,%d,%d", account1.Owner, account1.ID, account2.ID, account2.ID+1000),
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAccountsByIDsParams{
+					Ids: []int64{account1.ID, account2.ID, account2.ID + 1000},
+					Owner: pgtype.Text{String: account1.Owner, Valid: true},
+				}
+				store.EXPECT().ListAccountsByIDs(gomock.Any(), gomock.Eq(arg)).Times(1).Return([]db.Account{account1, account2}, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var body getAccountsBatchResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, []db.Account{account1, account2}, body.Accounts)
+			},
+		},
+		{
+			name: "NoOwnerFilter",
+			query: fmt.Sprintf("ids=%d", account1.ID),
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAccountsByIDsParams{Ids: []int64{account1.ID}}
+				store.EXPECT().ListAccountsByIDs(gomock.Any(), gomock.Eq(arg)).Times(1).Return([]db.Account{account1}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var body getAccountsBatchResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, []db.Account{account1}, body.Accounts)
+			},
+		},
+		{
+			name: "InvalidID",
+			query: fmt.Sprintf("owner=%s&ids=1,abc", account1.Owner),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountsByIDs(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "TooManyIDs",
+			query: fmt.Sprintf("owner=%s&ids=%s", account1.Owner, strings.Repeat("1,", maxBatchAccounts)+"1"),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountsByIDs(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts/batch?"+tc.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAccountByNumberAPI(t *testing.T) {
+	account := randomAccount("USD")
+
+	testCases := []struct {
+		name string
+		accountNumber string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			accountNumber: account.AccountNumber,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Eq(account.AccountNumber)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotEmpty(t, recorder.Header().Get("ETag"))
+
+				var got db.Account
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, account, got)
+			},
+		},
+		{
+			name: "NotFound",
+			accountNumber: account.AccountNumber,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidNumber",
+			accountNumber: "12ab",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts/by-number/"+tc.accountNumber, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListAccountsAPI(t *testing.T) {
+	account := randomAccount("USD")
+
+	testCases := []struct {
+		name string
+		query string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: "?page_id=1&page_size=5",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Eq(db.ListAccountsParams{Limit: 5})).Times(1).Return([]db.Account{account}, nil)
+				store.EXPECT().CountAccounts(gomock.Any(), gomock.Eq(db.CountAccountsParams{})).Times(1).Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "FilterByOwnerAndCurrency",
+			query: "?page_id=1&page_size=5&owner=" + account.Owner + "&currency=USD",
+			buildStubs: func(store *mockdb.MockStore) {
+				owner := pgtype.Text{String: account.Owner, Valid: true}
+				currency := pgtype.Text{String: "USD", Valid: true}
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Eq(db.ListAccountsParams{
+					Owner: owner,
+					Currency: currency,
+					Limit: 5,
+				})).Times(1).Return([]db.Account{account}, nil)
+				store.EXPECT().CountAccounts(gomock.Any(), gomock.Eq(db.CountAccountsParams{
+					Owner: owner,
+					Currency: currency,
+				})).Times(1).Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "1", recorder.Header().Get("X-Total-Count"))
+
+				var accounts []db.Account
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accounts))
+				require.Equal(t, []db.Account{account}, accounts)
+			},
+		},
+		{
+			name: "PageSizeClamped",
+			query: "?page_id=1&page_size=500",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Eq(db.ListAccountsParams{Limit: util.DefaultMaxPageSize})).Times(1).Return([]db.Account{account}, nil)
+				store.EXPECT().CountAccounts(gomock.Any(), gomock.Any()).Times(1).Return(int64(250), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "100", recorder.Header().Get("X-Page-Size"))
+				require.Equal(t, "100", recorder.Header().Get("X-Max-Page-Size"))
+				require.Equal(t, `</accounts?page_id=2&page_size=100>; rel="next"`, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name: "InvalidCurrency",
+			query: "?page_id=1&page_size=5&currency=GBP",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts"+tc.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCreateAccountsBatchAPI(t *testing.T) {
+	store := testutil.NewStore()
+	server := newTestServer(t, store)
+	owner := util.RandomOwner()
+
+	post := func(accounts []gin.H) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"accounts": accounts})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/accounts/batch", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	ownerAccounts := func(owner string) []db.Account {
+		accounts, err := store.ListAccounts(context.Background(), db.ListAccountsParams{
+			Owner: pgtype.Text{String: owner, Valid: true},
+			Limit: 10,
+		})
+		require.NoError(t, err)
+		return accounts
+	}
+
+	recorder := post([]gin.H{
+		{"owner": owner, "currency": util.USD, "initial_balance": 500},
+		{"owner": owner, "currency": util.EUR, "name": "payroll"},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var body createAccountsBatchResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Len(t, body.Accounts, 2)
+	require.Equal(t, int64(500), body.Accounts[0].Account.Balance)
+	require.NotNil(t, body.Accounts[0].OpeningEntry)
+	require.Equal(t, "payroll", body.Accounts[1].Account.Name.String)
+	require.Len(t, ownerAccounts(owner), 2)
+
+	//the duplicate USD account fails the batch, and the JPY account before it is rolled back
+	other := util.RandomOwner()
+	recorder = post([]gin.H{
+		{"owner": other, "currency": util.JPY},
+		{"owner": owner, "currency": util.USD},
+	})
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyCode(t, recorder, codeAccountExists)
+	require.Contains(t, recorder.Body.String(), "account 1: "+errAccountExists.Error())
+	require.Empty(t, ownerAccounts(other))
+
+	//every item is validated before anything is written
+	recorder = post([]gin.H{
+		{"owner": other, "currency": util.USD},
+		{"owner": other, "currency": "GBP"},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInvalidRequest)
+
+	recorder = post([]gin.H{{"owner": other}})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "account 0: "+errCurrencyRequired.Error())
+
+	recorder = post([]gin.H{})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	tooMany := make([]gin.H, maxBatchAccounts+1)
+	for i := range tooMany {
+		tooMany[i] = gin.H{"owner": util.RandomOwner(), "currency": util.USD}
+	}
+	recorder = post(tooMany)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Empty(t, ownerAccounts(other))
+}
+
+func TestGetAccountBalancesAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(1000)
+	account2 := newAccount(0)
+	_, err := store.AuthorizeTx(ctx, db.AuthorizeTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 300})
+	require.NoError(t, err)
+	server := newTestServer(t, store)
+
+	get := func(accountID int64) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/balances", accountID), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := get(account1.ID)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var balances accountBalancesResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &balances))
+	require.Equal(t, accountBalancesResponse{
+		AccountID: account1.ID,
+		Currency: util.USD,
+		LedgerBalance: 1000,
+		HeldBalance: 300,
+		AvailableBalance: 700,
+	}, balances)
+
+	//the hold isn't credited to the recipient until it's captured
+	recorder = get(account2.ID)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &balances))
+	require.Zero(t, balances.LedgerBalance)
+	require.Zero(t, balances.AvailableBalance)
+
+	recorder = get(account2.ID + 1000)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireBodyCode(t, recorder, codeAccountNotFound)
+}
+
+func TestGetAccountSummaryAPI(t *testing.T) {
+	account := randomAccount("USD")
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		query url.Values
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				//no range means all-time
+				store.EXPECT().GetEntryTotals(gomock.Any(), gomock.Eq(db.GetEntryTotalsParams{AccountID: account.ID})).Times(1).
+					Return(db.GetEntryTotalsRow{TotalDeposited: 500, TotalWithdrawn: 200}, nil)
+				store.EXPECT().CountAccountTransfers(gomock.Any(), gomock.Eq(db.CountAccountTransfersParams{AccountID: account.ID})).Times(1).
+					Return(db.CountAccountTransfersRow{Sent: 3, Received: 4}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got accountSummaryResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, accountSummaryResponse{
+					AccountID: account.ID,
+					Balance: account.Balance,
+					Currency: account.Currency,
+					TotalDeposited: 500,
+					TotalWithdrawn: 200,
+					TransfersSent: 3,
+					TransfersReceived: 4,
+				}, got)
+			},
+		},
+		{
+			name: "DateRange",
+			query: url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}},
+			buildStubs: func(store *mockdb.MockStore) {
+				fromTime := pgtype.Timestamp{Time: from, Valid: true}
+				toTime := pgtype.Timestamp{Time: to, Valid: true}
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().GetEntryTotals(gomock.Any(), gomock.Eq(db.GetEntryTotalsParams{
+					AccountID: account.ID,
+					FromTime: fromTime,
+					ToTime: toTime,
+				})).Times(1)
+				store.EXPECT().CountAccountTransfers(gomock.Any(), gomock.Eq(db.CountAccountTransfersParams{
+					AccountID: account.ID,
+					FromTime: fromTime,
+					ToTime: toTime,
+				})).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidDateRange",
+			query: url.Values{"from": {to.Format(time.RFC3339)}, "to": {from.Format(time.RFC3339)}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "NotFound",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().GetEntryTotals(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountNotFound)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().GetEntryTotals(gomock.Any(), gomock.Any()).Times(1).Return(db.GetEntryTotalsRow{}, errors.New("connection reset"))
+				store.EXPECT().CountAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireBodyCode(t, recorder, codeInternal)
+			},
+		},
+		{
+			name: "DeadlineExceeded",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().GetEntryTotals(gomock.Any(), gomock.Any()).Times(1)
+				store.EXPECT().CountAccountTransfers(gomock.Any(), gomock.Any()).Times(1).Return(db.CountAccountTransfersRow{}, context.DeadlineExceeded)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				requireBodyCode(t, recorder, codeTimeout)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/summary?%s", account.ID, tc.query.Encode()), nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestUpdateAccountCurrencyAPI(t *testing.T) {
+	account := randomAccount("USD")
+	account.Balance = 0
+	updated := account
+	updated.Currency = "EUR"
+
+	testCases := []struct {
+		name string
+		body gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Eq(db.UpdateAccountCurrencyParams{
+					ID: account.ID,
+					Currency: "EUR",
+				})).Times(1).Return(updated, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got db.Account
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, updated, got)
+			},
+		},
+		{
+			name: "UnsupportedCurrency",
+			body: gin.H{"currency": "XYZ"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "NotFound",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountNotFound)
+			},
+		},
+		{
+			name: "AccountInUse",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				//the guard in the UPDATE matched no row
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountInUse)
+			},
+		},
+		{
+			name: "OwnerHasCurrency",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				err := &pgconn.PgError{Code: db.UniqueViolation, ConstraintName: db.OwnerCurrencyKey}
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountExists)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, errors.New("connection reset"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireBodyCode(t, recorder, codeInternal)
+			},
+		},
+		{
+			name: "Canceled",
+			body: gin.H{"currency": "EUR"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().UpdateAccountCurrency(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, context.Canceled)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, statusClientClosedRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeRequestCanceled)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/accounts/%d/currency", account.ID), bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+)
+
+type listCurrenciesResponse struct {
+	Currencies []string `json:"currencies"`
+	//Decimals is the number of decimal places per currency, amounts are sent in the minor unit
+	Decimals map[string]int `json:"decimals"`
+}
+
+//listCurrencies returns the currencies accounts and transfers accept, so clients don't hardcode them
+func (server *Server) listCurrencies(ctx *gin.Context) {
+	currencies := util.SupportedCurrencies()
+	decimals := make(map[string]int, len(currencies))
+	for _, currency := range currencies {
+		decimals[currency] = util.CurrencyDecimals(currency)
+	}
+	ctx.JSON(http.StatusOK, listCurrenciesResponse{Currencies: currencies, Decimals: decimals})
+}
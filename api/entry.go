@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type listAccountEntriesURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type listAccountEntriesRequest struct {
+	PageID int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=1"`
+	//sign=positive lists money in, sign=negative money out, empty lists both
+	Sign string `form:"sign" binding:"omitempty,oneof=positive negative"`
+	dateRange
+}
+
+type listAccountEntriesResponse struct {
+	Entries []db.Entry `json:"entries"`
+	Total int64 `json:"total"`
+}
+
+//listAccountEntries returns a page of an account's entries plus the total matching the date range and sign
+//the total is also sent as X-Total-Count, with Link headers to the next and previous pages like the other lists
+func (server *Server) listAccountEntries(ctx *gin.Context) {
+	var uri listAccountEntriesURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req listAccountEntriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	req.PageSize = server.clampPageSize(ctx, req.PageSize)
+
+	if _, ok := server.getAccountOrRespond(ctx, uri.ID); !ok {
+		return
+	}
+	sign := pgtype.Text{String: req.Sign, Valid: req.Sign != ""}
+
+	entries, err := server.store.ListEntriesByAccount(ctx, db.ListEntriesByAccountParams{
+		AccountID: uri.ID,
+		FromTime: req.fromTime(),
+		ToTime: req.toTime(),
+		Sign: sign,
+		Limit: req.PageSize,
+		Offset: (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	total, err := server.store.CountEntriesByAccount(ctx, db.CountEntriesByAccountParams{
+		AccountID: uri.ID,
+		FromTime: req.fromTime(),
+		ToTime: req.toTime(),
+		Sign: sign,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	setPaginationHeaders(ctx, req.PageID, req.PageSize, total)
+
+	ctx.JSON(http.StatusOK, listAccountEntriesResponse{
+		Entries: entries,
+		Total: total,
+	})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestListAccountEntriesAPI(t *testing.T) {
+	account := randomAccount("USD")
+	entries := []db.Entry{
+		{ID: 1, AccountID: account.ID, Amount: 10},
+		{ID: 2, AccountID: account.ID, Amount: -5},
+	}
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		query string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: fmt.Sprintf("page_id=2&page_size=2&from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				arg := db.ListEntriesByAccountParams{
+					AccountID: account.ID,
+					FromTime: pgtype.Timestamp{Time: from, Valid: true},
+					ToTime: pgtype.Timestamp{Time: to, Valid: true},
+					Limit: 2,
+					Offset: 2,
+				}
+				store.EXPECT().ListEntriesByAccount(gomock.Any(), gomock.Eq(arg)).Times(1).Return(entries, nil)
+				store.EXPECT().CountEntriesByAccount(gomock.Any(), gomock.Eq(db.CountEntriesByAccountParams{
+					AccountID: account.ID,
+					FromTime: arg.FromTime,
+					ToTime: arg.ToTime,
+				})).Times(1).Return(int64(4), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var body listAccountEntriesResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, int64(4), body.Total)
+				require.Len(t, body.Entries, 2)
+				require.Equal(t, "4", recorder.Header().Get("X-Total-Count"))
+				//page 2 of 2, so only a prev link
+				link := recorder.Header().Get("Link")
+				require.Contains(t, link, `rel="prev"`)
+				require.NotContains(t, link, `rel="next"`)
+			},
+		},
+		{
+			name: "Negative",
+			query: "page_id=1&page_size=2&sign=negative",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				sign := pgtype.Text{String: "negative", Valid: true}
+				store.EXPECT().ListEntriesByAccount(gomock.Any(), gomock.Eq(db.ListEntriesByAccountParams{
+					AccountID: account.ID,
+					Sign: sign,
+					Limit: 2,
+				})).Times(1).Return(entries[1:], nil)
+				store.EXPECT().CountEntriesByAccount(gomock.Any(), gomock.Eq(db.CountEntriesByAccountParams{
+					AccountID: account.ID,
+					Sign: sign,
+				})).Times(1).Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidSign",
+			query: "page_id=1&page_size=2&sign=zero",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "FromAfterTo",
+			query: fmt.Sprintf("page_id=1&page_size=2&from=%s&to=%s", to.Format(time.RFC3339), from.Format(time.RFC3339)),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListEntriesByAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/entries?%s", account.ID, tc.query)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
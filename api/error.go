@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/go-playground/validator/v10"
+)
+
+//error codes are returned next to the message, so clients can branch on them instead of parsing English
+const (
+	codeInvalidRequest = "invalid_request"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeAccountNotFound = "account_not_found"
+	codeTransferNotFound = "transfer_not_found"
+	codeAccountExists = "account_exists"
+	codeAccountInUse = "account_in_use"
+	codeAccountNameTaken = "account_name_taken"
+	codeInvalidReference = "invalid_reference"
+	codeInsufficientBalance = "insufficient_balance"
+	codeClientIDReused = "client_id_reused"
+	codeExternalReferenceReused = "external_reference_reused"
+	codeLockTimeout = "lock_timeout"
+	codeAmountBelowMinimum = "amount_below_minimum"
+	codeCurrencyMismatch = "currency_mismatch"
+	codeDifferentOwners = "different_owners"
+	codeTransfersDisabled = "transfers_disabled"
+	codeMaintenance = "maintenance"
+	codeRequestCanceled = "request_canceled"
+	codeTimeout = "timeout"
+	codeInternal = "internal_error"
+)
+
+var (
+	errAccountNotFound = errors.New("account not found")
+	errTransferNotFound = errors.New("transfer not found")
+	//the sentinels below are wrapped with the ids and currencies involved
+	errCurrencyMismatch = errors.New("currency mismatch")
+	errDifferentOwners = errors.New("belong to different owners")
+	errSameAccount = errors.New("cannot transfer to itself")
+	errUnknownCategory = errors.New("unknown transfer category")
+)
+
+//errorCode maps an error to its code, anything unrecognised is reported as internal_error
+func errorCode(err error) string {
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var numErr *strconv.NumError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		return codeUnsupportedMediaType
+	case errors.Is(err, errAccountNotFound):
+		return codeAccountNotFound
+	case errors.Is(err, errTransferNotFound):
+		return codeTransferNotFound
+	case errors.Is(err, errAccountExists):
+		return codeAccountExists
+	case errors.Is(err, errAccountInUse):
+		return codeAccountInUse
+	case errors.Is(err, errAccountNameTaken):
+		return codeAccountNameTaken
+	case errors.Is(err, db.ErrInsufficientBalance):
+		return codeInsufficientBalance
+	case errors.Is(err, db.ErrAmountBelowMinimum):
+		return codeAmountBelowMinimum
+	case errors.Is(err, db.ErrClientIDReused):
+		return codeClientIDReused
+	case errors.Is(err, db.ErrExternalReferenceReused):
+		return codeExternalReferenceReused
+	case errors.Is(err, db.ErrLockTimeout):
+		return codeLockTimeout
+	case errors.Is(err, errCurrencyMismatch), errors.Is(err, db.ErrCurrencyMismatch):
+		return codeCurrencyMismatch
+	case errors.Is(err, errDifferentOwners):
+		return codeDifferentOwners
+	case errors.Is(err, errTransfersDisabled):
+		return codeTransfersDisabled
+	case errors.Is(err, errMaintenance):
+		return codeMaintenance
+	case errors.Is(err, errInvalidDateRange), errors.Is(err, errCurrencyRequired), errors.Is(err, errUnknownCategory), errors.Is(err, errSameAccount), errors.Is(err, errUnknownField), errors.Is(err, errInvalidIDs),
+		errors.Is(err, errInvalidMetadata), errors.Is(err, util.ErrInvalidAmount):
+		return codeInvalidRequest
+	case db.IsForeignKeyViolation(err):
+		return codeInvalidReference
+	case errors.Is(err, context.Canceled):
+		return codeRequestCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeTimeout
+	//request binding failures: failed validation, malformed JSON or unparsable uri/query values
+	case errors.As(err, &validationErrs), errors.As(err, &syntaxErr), errors.As(err, &typeErr),
+		errors.As(err, &numErr), errors.As(err, &timeErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return codeInvalidRequest
+	}
+	return codeInternal
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errUnknownField = errors.New("unknown field")
+
+var errInvalidIDs = errors.New("invalid ids")
+
+//parseFields splits a ?fields= value and checks every field against allowed
+//an empty value selects everything and returns nil
+func parseFields(value string, allowed map[string]bool) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	fields := strings.Split(value, ",")
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if !allowed[field] {
+			return nil, fmt.Errorf("%w %q", errUnknownField, field)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+//parseIDs splits a comma separated list of positive ids, allowing at most limit of them
+func parseIDs(value string, limit int) ([]int64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) > limit {
+		return nil, fmt.Errorf("%w: at most %d ids are allowed", errInvalidIDs, limit)
+	}
+	ids := make([]int64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%w: %q is not an account id", errInvalidIDs, part)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+//selectFields projects obj's JSON object to fields, with no fields obj is returned as is
+func selectFields(obj any, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return obj, nil
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, err
+	}
+
+	projection := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		projection[field] = all[field]
+	}
+	return projection, nil
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"os"
+	"testing"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		EnableTransfers: true,
+	}
+
+	return NewServer(config, store)
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	os.Exit(m.Run())
+}
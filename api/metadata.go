@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	//maxMetadataSize is the largest metadata accepted, in bytes of compact JSON
+	maxMetadataSize = 4096
+	//maxMetadataDepth is how deep objects and arrays may nest, the metadata object itself is level 1
+	maxMetadataDepth = 5
+)
+
+var errInvalidMetadata = errors.New("invalid metadata")
+
+type accountMetadataURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type accountMetadataRequest struct {
+	//Metadata replaces the account's metadata as a whole, {} clears it
+	Metadata json.RawMessage `json:"metadata" binding:"required"`
+}
+
+type accountMetadataResponse struct {
+	AccountID int64 `json:"account_id"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+//getAccountMetadata returns only the metadata of an account
+func (server *Server) getAccountMetadata(ctx *gin.Context) {
+	var uri accountMetadataURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	metadata, err := server.store.GetAccountMetadata(ctx, uri.ID)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, accountMetadataResponse{AccountID: uri.ID, Metadata: metadata})
+}
+
+//setAccountMetadata replaces the metadata of an account and returns the updated account
+func (server *Server) setAccountMetadata(ctx *gin.Context) {
+	var uri accountMetadataURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req accountMetadataRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	metadata, err := validateMetadata(req.Metadata)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, err := server.store.SetAccountMetadata(ctx, db.SetAccountMetadataParams{
+		ID: uri.ID,
+		Metadata: metadata,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
+
+//validateMetadata checks that metadata is a JSON object within maxMetadataSize and maxMetadataDepth
+//it returns the compacted form, so the size limit doesn't depend on the client's whitespace
+func validateMetadata(metadata json.RawMessage) (json.RawMessage, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMetadata, err)
+	}
+	if compact.Len() > maxMetadataSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", errInvalidMetadata, maxMetadataSize)
+	}
+	if compact.Bytes()[0] != '{' {
+		return nil, fmt.Errorf("%w: must be a JSON object", errInvalidMetadata)
+	}
+
+	//Compact already rejected malformed JSON, so only the nesting is left to check
+	decoder := json.NewDecoder(bytes.NewReader(compact.Bytes()))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidMetadata, err)
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxMetadataDepth {
+				return nil, fmt.Errorf("%w: nested deeper than %d levels", errInvalidMetadata, maxMetadataDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return compact.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/db/testutil"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountMetadataAPI(t *testing.T) {
+	store := testutil.NewStore()
+	result, err := store.CreateAccountTx(context.Background(), db.CreateAccountTxParams{
+		Owner: util.RandomOwner(),
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	account := result.Account
+	server := newTestServer(t, store)
+
+	serve := func(method string, accountID int64, body string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(method, fmt.Sprintf("/accounts/%d/metadata", accountID), strings.NewReader(body))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//a new account starts with an empty object
+	recorder := serve(http.MethodGet, account.ID, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, fmt.Sprintf(`{"account_id": %d, "metadata": {}}`, account.ID), recorder.Body.String())
+
+	recorder = serve(http.MethodPut, account.ID, `{"metadata": {"crm_id": "C-42", "labels": ["vip"]}}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var got map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	require.JSONEq(t, `{"crm_id": "C-42", "labels": ["vip"]}`, string(got["metadata"]))
+
+	//the account responses carry it too
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+	require.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	require.JSONEq(t, `{"crm_id": "C-42", "labels": ["vip"]}`, string(got["metadata"]))
+
+	recorder = serve(http.MethodPut, account.ID, `{"metadata": ["not", "an", "object"]}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInvalidRequest)
+
+	recorder = serve(http.MethodPut, account.ID, `{}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serve(http.MethodPut, account.ID+100, `{"metadata": {}}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireBodyCode(t, recorder, codeAccountNotFound)
+
+	recorder = serve(http.MethodGet, account.ID+100, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestValidateMetadata(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth)
+	}
+
+	testCases := []struct {
+		name string
+		metadata string
+		want string
+		wantErr bool
+	}{
+		{name: "Empty", metadata: `{}`, want: `{}`},
+		{name: "Compacted", metadata: "{ \"a\" : [1, 2],\n \"b\": null }", want: `{"a":[1,2],"b":null}`},
+		{name: "MaxDepth", metadata: nested(maxMetadataDepth), want: nested(maxMetadataDepth)},
+		{name: "TooDeep", metadata: nested(maxMetadataDepth + 1), wantErr: true},
+		{name: "ArraysCount", metadata: `{"a":[[[[[1]]]]]}`, wantErr: true},
+		{name: "Array", metadata: `[1]`, wantErr: true},
+		{name: "String", metadata: `"label"`, wantErr: true},
+		{name: "Null", metadata: `null`, wantErr: true},
+		{name: "Malformed", metadata: `{"a":}`, wantErr: true},
+		{name: "MaxSize", metadata: `{"a":"` + strings.Repeat("x", maxMetadataSize-8) + `"}`, want: `{"a":"` + strings.Repeat("x", maxMetadataSize-8) + `"}`},
+		{name: "TooLarge", metadata: `{"a":"` + strings.Repeat("x", maxMetadataSize-7) + `"}`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validateMetadata(json.RawMessage(tc.metadata))
+			if tc.wantErr {
+				require.ErrorIs(t, err, errInvalidMetadata)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, bytes.Equal([]byte(tc.want), got), string(got))
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+)
+
+var errUnsupportedMediaType = errors.New("Content-Type must be application/json")
+
+var errInternal = errors.New("internal server error")
+
+var errTransfersDisabled = errors.New("transfers are temporarily disabled")
+
+var errMaintenance = errors.New("the service is down for maintenance")
+
+//requireTransfers answers 503 while transfers are switched off by ENABLE_TRANSFERS
+func (server *Server) requireTransfers(ctx *gin.Context) {
+	if !server.config.EnableTransfers {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, errResponse(errTransfersDisabled))
+		return
+	}
+	ctx.Next()
+}
+
+//maintenanceTokenHeader carries MAINTENANCE_BYPASS_TOKEN for callers that must get through maintenance mode
+const maintenanceTokenHeader = "X-Maintenance-Token"
+
+//maintenanceExempt are the routes that keep answering in maintenance mode, so the load balancer and monitoring
+//don't take the instance for dead
+var maintenanceExempt = map[string]bool{
+	"/readyz": true,
+	"/metrics": true,
+}
+
+//maintenanceMode answers 503 to everyone but the allowlisted IPs and holders of the bypass token
+//the client IP is ctx.ClientIP(), so X-Forwarded-For only counts when it comes from TRUSTED_PROXIES
+//Validate has already rejected malformed allowlist entries, they are skipped here
+func maintenanceMode(config util.Config) gin.HandlerFunc {
+	var allowlist []netip.Prefix
+	for _, entry := range config.MaintenanceAllowlist {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			allowlist = append(allowlist, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if prefix, err := netip.ParsePrefix(entry); err == nil {
+			allowlist = append(allowlist, prefix.Masked())
+		}
+	}
+	allowed := func(ctx *gin.Context) bool {
+		token := ctx.GetHeader(maintenanceTokenHeader)
+		if config.MaintenanceBypassToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.MaintenanceBypassToken)) == 1 {
+			return true
+		}
+		addr, err := netip.ParseAddr(ctx.ClientIP())
+		if err != nil {
+			return false
+		}
+		for _, prefix := range allowlist {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(ctx *gin.Context) {
+		if !maintenanceExempt[ctx.FullPath()] && !allowed(ctx) {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, errResponse(errMaintenance))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+//requestIDHeader carries the id a proxy or client assigned to the request
+const requestIDHeader = "X-Request-ID"
+
+//recoverJSON replaces gin's recovery: a panicking handler is logged with its stack and answered with a JSON 500
+//the panic value isn't sent to the client, the request id is so the log entry can be found
+func recoverJSON() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				requestID := ctx.GetHeader(requestIDHeader)
+				slog.Error("handler panicked",
+					"panic", recovered,
+					"method", ctx.Request.Method,
+					"path", ctx.Request.URL.Path,
+					"request_id", requestID,
+					"stack", string(debug.Stack()),
+				)
+
+				body := errResponse(errInternal)
+				if requestID != "" {
+					body["request_id"] = requestID
+				}
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, body)
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+//requireJSON rejects POST, PUT and PATCH requests whose body isn't declared as JSON with 415
+//without it, a form-encoded body reaches ShouldBindJSON and fails with a confusing parse error
+func requireJSON() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			//ContentType drops parameters such as charset
+			if ctx.ContentType() != gin.MIMEJSON {
+				ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, errResponse(errUnsupportedMediaType))
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRequireJSON(t *testing.T) {
+	testCases := []struct {
+		name string
+		contentType string
+		body string
+	}{
+		{
+			name: "Form",
+			contentType: "application/x-www-form-urlencoded",
+			body: "from_account_id=1&to_account_id=2&amount=10&currency=USD",
+		},
+		{
+			name: "Missing",
+			body: `{"from_account_id":1,"to_account_id":2,"amount":10,"currency":"USD"}`,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			//the request never reaches the handler
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			if tc.contentType != "" {
+				request.Header.Set("Content-Type", tc.contentType)
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+			requireBodyError(t, recorder, errUnsupportedMediaType.Error())
+			requireBodyCode(t, recorder, codeUnsupportedMediaType)
+		})
+	}
+}
+
+func TestRecoverJSON(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.router.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/panic", nil)
+	require.NoError(t, err)
+	request.Header.Set(requestIDHeader, "req-123")
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	var body gin.H
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, errInternal.Error(), body["error"])
+	require.Equal(t, codeInternal, body["code"])
+	require.Equal(t, "req-123", body["request_id"])
+}
+
+func TestRequireTransfers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+
+	server := NewServer(util.Config{EnableTransfers: false}, store)
+
+	for _, url := range []string{"/transfers", "/accounts/1/transfer-to/2"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"amount":10}`))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		requireBodyCode(t, recorder, codeTransfersDisabled)
+	}
+
+	//reads keep working in read-only mode
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(int64(1))).Times(1).Return(randomAccount("USD"), nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/accounts/1", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	account := randomAccount("USD")
+	config := util.Config{
+		EnableTransfers: true,
+		MaintenanceMode: true,
+		MaintenanceAllowlist: []string{"192.168.1.10", "10.1.0.0/16"},
+		MaintenanceBypassToken: "let-me-in",
+	}
+
+	testCases := []struct {
+		name string
+		url string
+		remoteAddr string
+		header http.Header
+		wantStatus int
+	}{
+		{
+			name: "Blocked",
+			url: "/accounts/1",
+			remoteAddr: "203.0.113.5:4321",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "UnknownRoute",
+			url: "/nowhere",
+			remoteAddr: "203.0.113.5:4321",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "Readyz",
+			url: "/readyz",
+			remoteAddr: "203.0.113.5:4321",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Metrics",
+			url: "/metrics",
+			remoteAddr: "203.0.113.5:4321",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "AllowlistedIP",
+			url: "/accounts/1",
+			remoteAddr: "192.168.1.10:4321",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "AllowlistedCIDR",
+			url: "/accounts/1",
+			remoteAddr: "10.1.2.3:4321",
+			wantStatus: http.StatusOK,
+		},
+		{
+			//X-Forwarded-For is ignored, no proxy is trusted
+			name: "SpoofedForwardedFor",
+			url: "/accounts/1",
+			remoteAddr: "203.0.113.5:4321",
+			header: http.Header{"X-Forwarded-For": {"10.1.2.3"}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "BypassToken",
+			url: "/accounts/1",
+			remoteAddr: "203.0.113.5:4321",
+			header: http.Header{maintenanceTokenHeader: {"let-me-in"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "WrongToken",
+			url: "/accounts/1",
+			remoteAddr: "203.0.113.5:4321",
+			header: http.Header{maintenanceTokenHeader: {"let-me"}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().Ping(gomock.Any()).AnyTimes().Return(nil)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).AnyTimes().Return(account, nil)
+
+			server := NewServer(config, store)
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			request.RemoteAddr = tc.remoteAddr
+			for key, values := range tc.header {
+				request.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+
+			require.Equal(t, tc.wantStatus, recorder.Code)
+			if tc.wantStatus == http.StatusServiceUnavailable {
+				requireBodyCode(t, recorder, codeMaintenance)
+			}
+		})
+	}
+}
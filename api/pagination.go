@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+)
+
+//clampPageSize limits pageSize to the server's MAX_PAGE_SIZE, whatever the binding allowed
+//the effective size and the cap are sent as X-Page-Size and X-Max-Page-Size
+func (server *Server) clampPageSize(ctx *gin.Context, pageSize int32) int32 {
+	maxPageSize := server.config.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = util.DefaultMaxPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	ctx.Header("X-Page-Size", strconv.Itoa(int(pageSize)))
+	ctx.Header("X-Max-Page-Size", strconv.Itoa(int(maxPageSize)))
+	return pageSize
+}
+
+//setPaginationHeaders writes X-Total-Count and a Link header with rel=next/prev page URLs
+//the links keep the request's other query params and only change page_id and page_size
+func setPaginationHeaders(ctx *gin.Context, pageID int32, pageSize int32, total int64) {
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	var links []string
+	if int64(pageID)*int64(pageSize) < total {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(ctx, pageID+1, pageSize)))
+	}
+	if pageID > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(ctx, pageID-1, pageSize)))
+	}
+	if len(links) > 0 {
+		ctx.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(ctx *gin.Context, pageID int32, pageSize int32) string {
+	u := *ctx.Request.URL
+	query := u.Query()
+	query.Set("page_id", strconv.Itoa(int(pageID)))
+	//a clamped page_size is replaced, so following the links doesn't skip rows
+	query.Set("page_size", strconv.Itoa(int(pageSize)))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
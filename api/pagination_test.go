@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPaginationHeaders(t *testing.T) {
+	testCases := []struct {
+		name string
+		pageID int32
+		total int64
+		link string
+	}{
+		{
+			name: "FirstPage",
+			pageID: 1,
+			total: 12,
+			link: `</accounts?page_id=2&page_size=5&sort=id>; rel="next"`,
+		},
+		{
+			name: "MiddlePage",
+			pageID: 2,
+			total: 12,
+			link: `</accounts?page_id=3&page_size=5&sort=id>; rel="next", </accounts?page_id=1&page_size=5&sort=id>; rel="prev"`,
+		},
+		{
+			name: "LastPage",
+			pageID: 3,
+			total: 12,
+			link: `</accounts?page_id=2&page_size=5&sort=id>; rel="prev"`,
+		},
+		{
+			name: "OnlyPage",
+			pageID: 1,
+			total: 5,
+			link: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/accounts?page_size=5&page_id=1&sort=id", nil)
+
+			setPaginationHeaders(ctx, tc.pageID, 5, tc.total)
+
+			require.Equal(t, strconv.FormatInt(tc.total, 10), recorder.Header().Get("X-Total-Count"))
+			require.Equal(t, tc.link, recorder.Header().Get("Link"))
+		})
+	}
+}
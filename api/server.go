@@ -1,35 +1,215 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+	"time"
+
 	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //server services HTTP request for our balancing service.
 type Server struct {
-	store *db.Store
+	config util.Config
+	store db.Store
 	router *gin.Engine
+	//clock is where handlers get the current time, tests replace it with a util.FixedClock
+	clock util.Clock
+	httpServer *http.Server
+	//metricsServer serves /metrics and pprof on MetricsAddress, it's nil when /metrics is on the API router
+	metricsServer *http.Server
+	//ready is what /readyz reports, Shutdown clears it before the server stops accepting connections
+	ready atomic.Bool
 }
 
 //NewServer creates a new HTTP server and setup routing.
-func NewServer(store *db.Store) *Server {
-	server := &Server{store: store}
-	router := gin.Default()
+func NewServer(config util.Config, store db.Store) *Server {
+	server := &Server{
+		config: config,
+		store: store,
+		clock: util.RealClock{},
+	}
+	server.ready.Store(true)
+	router := gin.New()
+	//ctx.ClientIP() only follows X-Forwarded-For from these proxies, an empty list trusts none
+	//Validate has already rejected malformed entries, and on error gin trusts none as well
+	router.SetTrustedProxies(config.TrustedProxies)
+	router.Use(gin.Logger(), recoverJSON())
+	if config.MaintenanceMode {
+		router.Use(maintenanceMode(config))
+	}
+	//let store calls see the request context, so they stop when the client goes away
+	router.ContextWithFallback = true
+	router.Use(requireJSON())
+
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("currency", validCurrency)
+		v.RegisterValidation("account_number", validAccountNumber)
+	}
 
 	router.POST("/accounts", server.createAccount)
+	router.POST("/accounts/batch", server.createAccountsBatch)
 	router.GET("/accounts/:id", server.getAccount)
+	router.GET("/accounts/by-number/:number", server.getAccountByNumber)
+	router.GET("/accounts/batch", server.getAccountsBatch)
 	router.GET("/accounts", server.listAccount)
+	router.GET("/accounts/:id/summary", server.getAccountSummary)
+	router.GET("/accounts/:id/balances", server.getAccountBalances)
+	router.GET("/accounts/:id/entries", server.listAccountEntries)
+	router.GET("/accounts/:id/transfers", server.listAccountTransfers)
+	router.GET("/accounts/:id/last-transfer", server.getLastAccountTransfer)
+	router.GET("/accounts/:id/statement.csv", server.exportStatement)
+	router.PATCH("/accounts/:id/currency", server.updateAccountCurrency)
+	router.PATCH("/accounts/:id/name", server.updateAccountName)
+	router.GET("/accounts/:id/metadata", server.getAccountMetadata)
+	router.PUT("/accounts/:id/metadata", server.setAccountMetadata)
+	router.POST("/accounts/:id/transfer-to/:otherId", server.requireTransfers, server.internalTransfer)
+
+	router.GET("/currencies", server.listCurrencies)
+
+	if config.MetricsAddress == "" {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	} else {
+		server.metricsServer = &http.Server{Addr: config.MetricsAddress, Handler: metricsHandler()}
+	}
+	router.GET("/readyz", server.readyz)
+
+	router.POST("/transfers", server.requireTransfers, server.createTransfer)
+	router.POST("/transfers/by-username", server.requireTransfers, server.createTransferByUsername)
+	router.GET("/transfers/:id", server.getTransfer)
 
 
 	server.router = router
+	server.httpServer = &http.Server{Handler: router}
 	return server
 }
 
 //start runs the HTTP server on a specific address.
+//it serves HTTPS instead when the config has a TLS certificate and key
+//it returns nil once Shutdown has stopped the server
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	server.httpServer.Addr = address
+	var err error
+	if server.config.TLSEnabled() {
+		err = server.httpServer.ListenAndServeTLS(server.config.TLSCertFile, server.config.TLSKeyFile)
+	} else {
+		err = server.httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+//StartMetrics runs the metrics listener on MetricsAddress, only call it when that is set
+//it returns nil once Shutdown has stopped the listener
+func (server *Server) StartMetrics() error {
+	err := server.metricsServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+//metricsHandler serves /metrics and the pprof endpoints under /debug/pprof/
+//pprof exposes stacks and command lines, so it's only ever mounted on the internal metrics listener
+func metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+//Shutdown drains the server: /readyz turns 503 at once, so the load balancer stops sending new requests,
+//then after drainDelay the server stops accepting connections and waits for in-flight requests until ctx is done
+func (server *Server) Shutdown(ctx context.Context, drainDelay time.Duration) error {
+	server.ready.Store(false)
+
+	select {
+	case <-time.After(drainDelay):
+	case <-ctx.Done():
+	}
+	err := server.httpServer.Shutdown(ctx)
+	//the metrics listener stays up through the drain, so scrapes still see it
+	if server.metricsServer != nil {
+		err = errors.Join(err, server.metricsServer.Shutdown(ctx))
+	}
+	return err
+}
+
+type readyzDB struct {
+	OK bool `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error string `json:"error,omitempty"`
+}
+
+type readyzResponse struct {
+	Status string `json:"status"`
+	DB *readyzDB `json:"db,omitempty"`
+}
+
+//readyz reports whether the server takes traffic along with the database ping latency
+//it answers 503 while draining, when the ping fails, or when it takes longer than DB_PING_THRESHOLD
+func (server *Server) readyz(ctx *gin.Context) {
+	if !server.ready.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, readyzResponse{Status: "draining"})
+		return
+	}
+
+	pingCtx := context.Context(ctx)
+	threshold := server.config.DBPingThreshold
+	if threshold > 0 {
+		var cancel context.CancelFunc
+		pingCtx, cancel = context.WithTimeout(ctx, threshold)
+		defer cancel()
+	}
+	start := server.clock.Now()
+	err := server.store.Ping(pingCtx)
+	latency := server.clock.Now().Sub(start)
+
+	dbStatus := &readyzDB{OK: err == nil, LatencyMS: float64(latency.Microseconds()) / 1000}
+	if err == nil && threshold > 0 && latency > threshold {
+		err = fmt.Errorf("ping took %s, more than the %s threshold", latency, threshold)
+		dbStatus.OK = false
+	}
+	if err != nil {
+		dbStatus.Error = err.Error()
+		ctx.JSON(http.StatusServiceUnavailable, readyzResponse{Status: "unavailable", DB: dbStatus})
+		return
+	}
+	ctx.JSON(http.StatusOK, readyzResponse{Status: "ok", DB: dbStatus})
 }
 
 func errResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
-}
\ No newline at end of file
+	return gin.H{"error": err.Error(), "code": errorCode(err)}
+}
+
+//statusClientClosedRequest is the non-standard status nginx uses when the client goes away mid-request
+const statusClientClosedRequest = 499
+
+//handleContextError responds with 499 if the request was cancelled or 503 if it ran out of time
+//it returns false when err is not caused by the request context, leaving the response to the caller
+func handleContextError(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		ctx.JSON(statusClientClosedRequest, errResponse(err))
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		ctx.JSON(http.StatusServiceUnavailable, errResponse(err))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMetricsAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	server := newTestServer(t, mockdb.NewMockStore(ctrl))
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "simplebank_transfers_in_flight 0")
+}
+
+func TestMetricsAddress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	server := NewServer(util.Config{MetricsAddress: "127.0.0.1:9090"}, mockdb.NewMockStore(ctrl))
+	get := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//the public API no longer exposes metrics
+	recorder := get(server.router, "/metrics")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = get(server.router, "/debug/pprof/")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	require.NotNil(t, server.metricsServer)
+	require.Equal(t, "127.0.0.1:9090", server.metricsServer.Addr)
+	recorder = get(server.metricsServer.Handler, "/metrics")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "simplebank_transfers_in_flight 0")
+	recorder = get(server.metricsServer.Handler, "/debug/pprof/")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = get(server.metricsServer.Handler, "/accounts")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestTrustedProxies(t *testing.T) {
+	testCases := []struct {
+		name string
+		trustedProxies []string
+		remoteAddr string
+		clientIP string
+	}{
+		{
+			name: "TrustNoneByDefault",
+			remoteAddr: "10.1.2.3:4000",
+			clientIP: "10.1.2.3",
+		},
+		{
+			name: "TrustedProxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr: "10.1.2.3:4000",
+			clientIP: "203.0.113.7",
+		},
+		{
+			name: "UntrustedProxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr: "192.168.1.2:4000",
+			clientIP: "192.168.1.2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(util.Config{TrustedProxies: tc.trustedProxies}, nil)
+			server.router.GET("/client-ip", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, ctx.ClientIP())
+			})
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/client-ip", nil)
+			require.NoError(t, err)
+			request.RemoteAddr = tc.remoteAddr
+			request.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.clientIP, recorder.Body.String())
+		})
+	}
+}
+
+func TestReadyzAPI(t *testing.T) {
+	testCases := []struct {
+		name string
+		buildStubs func(store *mockdb.MockStore, clock *util.FixedClock)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, clock *util.FixedClock) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context) error {
+					clock.T = clock.T.Add(12 * time.Millisecond)
+					return nil
+				})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"status": "ok", "db": {"ok": true, "latency_ms": 12}}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "PingFails",
+			buildStubs: func(store *mockdb.MockStore, clock *util.FixedClock) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(errors.New("connection refused"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.JSONEq(t, `{"status": "unavailable", "db": {"ok": false, "latency_ms": 0, "error": "connection refused"}}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "SlowerThanThreshold",
+			buildStubs: func(store *mockdb.MockStore, clock *util.FixedClock) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context) error {
+					clock.T = clock.T.Add(1500 * time.Millisecond)
+					return nil
+				})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				var body readyzResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.False(t, body.DB.OK)
+				require.Equal(t, float64(1500), body.DB.LatencyMS)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			clock := &util.FixedClock{T: time.Now()}
+			tc.buildStubs(store, clock)
+
+			server := NewServer(util.Config{DBPingThreshold: time.Second}, store)
+			server.clock = clock
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestHandleContextErrorAPI(t *testing.T) {
+	account1 := randomAccount("USD")
+	account2 := randomAccount("USD")
+	account2.ID = account1.ID + 1
+	transferBody, err := json.Marshal(gin.H{
+		"from_account_id": account1.ID,
+		"to_account_id": account2.ID,
+		"amount": 10,
+		"currency": "USD",
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		method string
+		url string
+		body []byte
+		buildStubs func(store *mockdb.MockStore)
+		status int
+		code string
+	}{
+		{
+			name: "GetAccountCanceled",
+			method: http.MethodGet,
+			url: fmt.Sprintf("/accounts/%d", account1.ID),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, context.Canceled)
+			},
+			status: statusClientClosedRequest,
+			code: codeRequestCanceled,
+		},
+		{
+			name: "GetAccountDeadlineExceeded",
+			method: http.MethodGet,
+			url: fmt.Sprintf("/accounts/%d", account1.ID),
+			buildStubs: func(store *mockdb.MockStore) {
+				//pgx wraps the context error
+				err := fmt.Errorf("query failed: %w", context.DeadlineExceeded)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, err)
+			},
+			status: http.StatusServiceUnavailable,
+			code: codeTimeout,
+		},
+		{
+			name: "GetAccountInternalError",
+			method: http.MethodGet,
+			url: fmt.Sprintf("/accounts/%d", account1.ID),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, errors.New("connection reset"))
+			},
+			status: http.StatusInternalServerError,
+			code: codeInternal,
+		},
+		{
+			name: "TransferDeadlineExceeded",
+			method: http.MethodPost,
+			url: "/transfers",
+			body: transferBody,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, context.DeadlineExceeded)
+			},
+			status: http.StatusServiceUnavailable,
+			code: codeTimeout,
+		},
+		{
+			name: "TransferCanceled",
+			method: http.MethodPost,
+			url: "/transfers",
+			body: transferBody,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, context.Canceled)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			status: statusClientClosedRequest,
+			code: codeRequestCanceled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+			require.NoError(t, err)
+			if tc.body != nil {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.status, recorder.Code)
+			requireBodyCode(t, recorder, tc.code)
+		})
+	}
+}
+
+func TestShutdownDrainsReadiness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().Ping(gomock.Any()).AnyTimes().Return(nil)
+	server := newTestServer(t, store)
+	readyz := func() int {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	require.Equal(t, http.StatusOK, readyz())
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start("127.0.0.1:0")
+	}()
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- server.Shutdown(context.Background(), 100*time.Millisecond)
+	}()
+
+	//readiness fails during the drain delay, before the server stops
+	require.Eventually(t, func() bool { return readyz() == http.StatusServiceUnavailable }, time.Second, time.Millisecond)
+	require.NoError(t, <-shutdown)
+	require.NoError(t, <-started)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+)
+
+type exportStatementURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type exportStatementRequest struct {
+	dateRange
+}
+
+//statementColumns is the header row of the CSV statement
+var statementColumns = []string{
+	"kind",
+	"transfer_id",
+	"entry_id",
+	"created_at",
+	"direction",
+	"counterparty_account_number",
+	"amount",
+	"fee",
+	"currency",
+	"description",
+	"category",
+}
+
+//statementFlushRows is how many rows are buffered before they are flushed to the client
+const statementFlushRows = 100
+
+//exportStatement streams the account's statement lines between from and to as CSV, oldest first
+//a line is a completed transfer, the opening balance or a fee collected on someone else's transfer, see ListStatementLines
+//holds that are still pending or were voided never moved money, so they aren't listed
+//amount is the signed change to this account's balance, the fee is part of it for sent transfers
+//anyone can export any account's statement, ownership isn't enforced until the server has authentication
+//rows are written as they come off the database cursor, so a long statement is never held in memory,
+//which also means an error halfway through can only cut the file short, see streamFailed
+func (server *Server) exportStatement(ctx *gin.Context) {
+	var uri exportStatementURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req exportStatementRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	from, to := req.closed(server.clock.Now(), statementPeriod)
+
+	account, ok := server.getAccountOrRespond(ctx, uri.ID)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.csv", account.AccountNumber, from.Format("20060102"), to.Format("20060102"))
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	w := csv.NewWriter(ctx.Writer)
+	rows := 0
+	err := w.Write(statementColumns)
+	if err == nil {
+		err = server.store.StreamStatementLines(ctx, db.ListStatementLinesParams{
+			AccountID: account.ID,
+			FromTime: from,
+			ToTime: to,
+		}, func(row db.ListStatementLinesRow) error {
+			if err := w.Write(statementRow(account, row)); err != nil {
+				return err
+			}
+			rows++
+			if rows%statementFlushRows == 0 {
+				w.Flush()
+				ctx.Writer.Flush()
+			}
+			return w.Error()
+		})
+	}
+	if err != nil {
+		streamFailed(ctx, err, account.ID, rows)
+		return
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		streamFailed(ctx, err, account.ID, rows)
+	}
+}
+
+//statementRow is the CSV row of line in account's statement, the ids are empty where the line has none
+func statementRow(account db.Account, line db.ListStatementLinesRow) []string {
+	direction := "in"
+	if line.Amount < 0 {
+		direction = "out"
+	}
+	return []string{
+		line.Kind,
+		formatOptionalID(line.TransferID),
+		formatOptionalID(line.EntryID),
+		line.CreatedAt.UTC().Format(time.RFC3339),
+		direction,
+		line.CounterpartyAccountNumber,
+		util.FormatAmount(line.Amount, account.Currency),
+		util.FormatAmount(line.Fee, account.Currency),
+		account.Currency,
+		csvSafe(line.Description),
+		csvSafe(line.Category),
+	}
+}
+
+//formatOptionalID formats id, 0 (no row) is an empty cell
+func formatOptionalID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+//csvSafe keeps a spreadsheet from evaluating a user written cell as a formula
+//a cell starting with = + - @ tab or carriage return gets a leading ', which spreadsheets show as text
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+//mimeNDJSON is newline delimited JSON, one value per line
+const mimeNDJSON = "application/x-ndjson"
+
+//wantsNDJSON reports whether the Accept header prefers NDJSON over JSON, */* and no header get JSON
+func wantsNDJSON(ctx *gin.Context) bool {
+	return ctx.NegotiateFormat(gin.MIMEJSON, mimeNDJSON) == mimeNDJSON
+}
+
+type streamAccountTransfersRequest struct {
+	transferFilterQuery
+	dateRange
+}
+
+//streamAccountTransfers is listAccountTransfers for Accept: application/x-ndjson
+//instead of a page it writes every transfer in the range, oldest first, one ListStatementTransfersRow per line,
+//as the rows come off the database cursor, page_id and page_size are ignored and there is no total
+func (server *Server) streamAccountTransfers(ctx *gin.Context, accountID int64) {
+	var req streamAccountTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	from, to := req.closed(server.clock.Now(), statementPeriod)
+
+	if _, ok := server.getAccountOrRespond(ctx, accountID); !ok {
+		return
+	}
+
+	ctx.Header("Content-Type", mimeNDJSON)
+	w := bufio.NewWriter(ctx.Writer)
+	encoder := json.NewEncoder(w)
+	rows := 0
+	err := server.store.StreamStatementTransfers(ctx, db.ListStatementTransfersParams{
+		AccountID: accountID,
+		FromTime: from,
+		ToTime: to,
+		Status: req.status(),
+		Category: req.category(),
+	}, func(row db.ListStatementTransfersRow) error {
+		//Encode ends every value with a newline
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%statementFlushRows == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		streamFailed(ctx, err, accountID, rows)
+	}
+}
+
+//streamFailed handles an error while streaming rows into the response
+//before anything was sent it's still a regular JSON error, after that the body can only be cut short,
+//so the error is logged and the response aborted
+func streamFailed(ctx *gin.Context, err error, accountID int64, rows int) {
+	if !ctx.Writer.Written() {
+		ctx.Writer.Header().Del("Content-Disposition")
+		ctx.Writer.Header().Del("Content-Type")
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	slog.Error("stream cut short", "path", ctx.FullPath(), "account_id", accountID, "rows", rows, "error", err)
+	ctx.Abort()
+}
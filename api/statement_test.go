@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/db/testutil"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExportStatementAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(1000)
+	account2 := newAccount(1000)
+	feeAccount := newAccount(0)
+	_, err := store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 250,
+		Fee: db.TransferFee{Fixed: 5, AccountID: feeAccount.ID},
+	})
+	require.NoError(t, err)
+	_, err = store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID: account1.ID,
+		Amount: 100,
+		Description: pgtype.Text{String: "rent, march", Valid: true},
+		Category: pgtype.Text{String: "housing", Valid: true},
+	})
+	require.NoError(t, err)
+	_, err = store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID: account1.ID,
+		Amount: 1,
+		Description: pgtype.Text{String: "=HYPERLINK(\"http://example.com\")", Valid: true},
+		Category: pgtype.Text{String: "@SUM(A1)", Valid: true},
+	})
+	require.NoError(t, err)
+	//holds only move money once captured, a voided and a pending one aren't on the statement
+	voided, err := store.AuthorizeTx(ctx, db.AuthorizeTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30})
+	require.NoError(t, err)
+	_, err = store.VoidTx(ctx, voided.Transfer.ID)
+	require.NoError(t, err)
+	_, err = store.AuthorizeTx(ctx, db.AuthorizeTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 40})
+	require.NoError(t, err)
+	//an entry written before entries.transfer_id existed, its transfer's line already covers it
+	_, err = store.CreateEntry(ctx, db.CreateEntryParams{AccountID: account1.ID, Amount: -5})
+	require.NoError(t, err)
+	server := newTestServer(t, store)
+
+	get := func(accountID int64, query url.Values) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/statement.csv?%s", accountID, query.Encode()), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := get(account1.ID, url.Values{})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.True(t, strings.HasPrefix(recorder.Header().Get("Content-Disposition"), `attachment; filename="statement-`+account1.AccountNumber))
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	require.Equal(t, statementColumns, records[0])
+	require.Equal(t, []string{"opening_balance", ""}, records[1][:2])
+	require.NotEmpty(t, records[1][2])
+	require.Equal(t, []string{"in", "", "10.00", "0.00", "USD", "", ""}, records[1][4:])
+	require.Equal(t, "transfer", records[2][0])
+	require.Empty(t, records[2][2])
+	require.Equal(t, []string{"out", account2.AccountNumber, "-2.55", "0.05", "USD", "", ""}, records[2][4:])
+	require.Equal(t, []string{"in", account2.AccountNumber, "1.00", "0.00", "USD", "rent, march", "housing"}, records[3][4:])
+	//user written cells can't be read as formulas by a spreadsheet
+	require.Equal(t, []string{"in", account2.AccountNumber, "0.01", "0.00", "USD", `'=HYPERLINK("http://example.com")`, "'@SUM(A1)"}, records[4][4:])
+
+	//the fee account opened empty, its only line is the fee it collected on account1's transfer
+	recorder = get(feeAccount.ID, url.Values{})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	records, err = csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "fee", records[1][0])
+	require.NotEmpty(t, records[1][2])
+	require.Equal(t, []string{"in", account1.AccountNumber, "0.05", "0.00", "USD", "", ""}, records[1][4:])
+
+	//a range before the transfers has only the header
+	recorder = get(account1.ID, url.Values{
+		"to": {time.Now().Add(-time.Hour).Format(time.RFC3339)},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	records, err = csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	recorder = get(feeAccount.ID+100, url.Values{})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = get(account1.ID, url.Values{
+		"from": {time.Now().Format(time.RFC3339)},
+		"to": {time.Now().Add(-time.Hour).Format(time.RFC3339)},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestCSVSafe(t *testing.T) {
+	for cell, want := range map[string]string{
+		"": "",
+		"rent": "rent",
+		"=1+1": "'=1+1",
+		"+1": "'+1",
+		"-1": "'-1",
+		"@SUM(A1)": "'@SUM(A1)",
+		"\tcmd": "'\tcmd",
+		"\r=1": "'\r=1",
+		"a=b": "a=b",
+	} {
+		require.Equal(t, want, csvSafe(cell), cell)
+	}
+}
+
+func TestExportStatementStoreErrorAPI(t *testing.T) {
+	account := randomAccount(util.USD)
+
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetAccount(gomock.Any(), account.ID).Times(1).Return(account, nil)
+	store.EXPECT().StreamStatementLines(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(errors.New("connection lost"))
+
+	server := newTestServer(t, store)
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/statement.csv", account.ID), nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+
+	//nothing was sent yet, so the failure is still a plain json error
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Content-Disposition"))
+	require.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+}
+
+func TestListAccountTransfersNDJSONAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func() db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: 1000,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount()
+	account2 := newAccount()
+	const n = statementFlushRows + 5
+	for range n {
+		_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 1})
+		require.NoError(t, err)
+	}
+	server := newTestServer(t, store)
+
+	get := func(accept string, query string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/transfers?%s", account1.ID, query), nil)
+		require.NoError(t, err)
+		request.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//no page params needed, every row of the range is streamed
+	recorder := get(mimeNDJSON, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, mimeNDJSON, recorder.Header().Get("Content-Type"))
+
+	body := recorder.Body.String()
+	decoder := json.NewDecoder(strings.NewReader(body))
+	var lastID int64
+	rows := 0
+	for decoder.More() {
+		var row db.ListStatementTransfersRow
+		require.NoError(t, decoder.Decode(&row))
+		require.Greater(t, row.Transfer.ID, lastID)
+		require.Equal(t, account2.Owner, row.ToOwner)
+		lastID = row.Transfer.ID
+		rows++
+	}
+	require.Equal(t, n, rows)
+	require.Equal(t, n, strings.Count(body, "\n"))
+
+	recorder = get(mimeNDJSON, "status=pending")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+
+	recorder = get(mimeNDJSON, "status=done")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	//anything else is the paginated JSON page
+	recorder = get("*/*", "page_id=1&page_size=5")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var page listAccountTransfersResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	require.Len(t, page.Transfers, 5)
+	require.Equal(t, int64(n), page.Total)
+
+	recorder = get("*/*", "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
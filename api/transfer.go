@@ -0,0 +1,593 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type transferRequest struct {
+	//the sender is given either by id or by its public account number
+	FromAccountID int64 `json:"from_account_id" binding:"required_without=FromAccountNumber,excluded_with=FromAccountNumber,gte=0"`
+	FromAccountNumber string `json:"from_account_number" binding:"omitempty,account_number"`
+	//the recipient is given by id, by account number, or by its owner and account name
+	ToAccountID int64 `json:"to_account_id" binding:"required_without_all=ToAccountNumber ToName,excluded_with=ToAccountNumber ToName,gte=0"`
+	ToAccountNumber string `json:"to_account_number" binding:"omitempty,excluded_with=ToName,account_number"`
+	ToOwner string `json:"to_owner" binding:"required_with=ToName"`
+	ToName string `json:"to_name" binding:"required_with=ToOwner"`
+	//the amount is given either in the currency's minor unit, or as a decimal string like "12.34"
+	Amount int64 `json:"amount" binding:"required_without=AmountDecimal,excluded_with=AmountDecimal,gte=0"`
+	AmountDecimal string `json:"amount_decimal"`
+	Currency string `json:"currency" binding:"required,currency"`
+	Description string `json:"description" binding:"max=255"`
+	//ClientID makes retries safe: sending the same uuid again returns the first transfer instead of a second one
+	ClientID string `json:"client_id" binding:"omitempty,uuid"`
+	//Category is an optional label for budgeting, restricted to TRANSFER_CATEGORIES when that is set
+	Category string `json:"category" binding:"max=32"`
+	//ExternalReference is the sender's own id for reconciliation, unique per sending account
+	//sending it again returns the first transfer, like ClientID
+	ExternalReference string `json:"external_reference" binding:"max=64"`
+}
+
+type transferQuery struct {
+	//ReturnStatement adds the first page of the sender's statement to the response, saving the client a GET
+	ReturnStatement bool `form:"return_statement"`
+}
+
+//statementPageSize is the size of the statement page returned with return_statement=true
+const statementPageSize = 10
+
+type transferWithStatementResponse struct {
+	db.TransferTxResult
+	//nil if the statement couldn't be read, the transfer went through regardless
+	Statement *listAccountTransfersResponse `json:"statement"`
+}
+
+func (server *Server) createTransfer(ctx *gin.Context) {
+	var req transferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var query transferQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if req.AmountDecimal != "" {
+		amount, err := util.ParseAmount(req.AmountDecimal, req.Currency)
+		if err == nil && amount == 0 {
+			err = fmt.Errorf("%w: amount must be positive", util.ErrInvalidAmount)
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errResponse(err))
+			return
+		}
+		req.Amount = amount
+	}
+	if !server.config.IsTransferCategory(req.Category) {
+		ctx.JSON(http.StatusBadRequest, errResponse(fmt.Errorf("%w %q", errUnknownCategory, req.Category)))
+		return
+	}
+
+	attempt := transferAttempt{
+		FromAccountID: req.FromAccountID,
+		ToAccountID: req.ToAccountID,
+		Amount: req.Amount,
+		Currency: req.Currency,
+	}
+	fromAccount, ok := server.resolveAccount(ctx, req.FromAccountID, req.FromAccountNumber)
+	if !ok {
+		return
+	}
+	attempt.FromAccountID = fromAccount.ID
+	if !checkCurrency(ctx, fromAccount, attempt) {
+		return
+	}
+	toAccount, ok := server.resolveToAccount(ctx, req)
+	if !ok {
+		return
+	}
+	attempt.ToAccountID = toAccount.ID
+	if !checkCurrency(ctx, toAccount, attempt) {
+		return
+	}
+
+	details := transferDetails{Description: req.Description, Category: req.Category, ExternalReference: req.ExternalReference}
+	if req.ClientID != "" {
+		if err := details.ClientID.Scan(req.ClientID); err != nil {
+			ctx.JSON(http.StatusBadRequest, errResponse(err))
+			return
+		}
+	}
+
+	result, ok := server.transfer(ctx, attempt, details)
+	if !ok {
+		return
+	}
+	if !query.ReturnStatement {
+		ctx.JSON(http.StatusOK, result)
+		return
+	}
+
+	response := transferWithStatementResponse{TransferTxResult: result}
+	from, to := dateRange{}.closed(server.clock.Now(), statementPeriod)
+	statement, err := server.accountStatement(ctx, result.Transfer.FromAccountID, from, to, transferFilterQuery{}, 1, statementPageSize)
+	if err != nil {
+		//failing the request now would invite a retry of a transfer that already happened
+		slog.Warn("cannot read statement after transfer", "transfer_id", result.Transfer.ID, "error", err)
+	} else {
+		response.Statement = &statement
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+type transferByUsernameRequest struct {
+	FromAccountID int64 `json:"from_account_id" binding:"required,min=1"`
+	ToUsername string `json:"to_username" binding:"required"`
+	Amount int64 `json:"amount" binding:"required,gt=0"`
+	Currency string `json:"currency" binding:"required,currency"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+//createTransferByUsername sends money to the recipient's account in the transfer currency
+//owners hold at most one account per currency (owner_currency_key), so the recipient is never ambiguous
+func (server *Server) createTransferByUsername(ctx *gin.Context) {
+	var req transferByUsernameRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	attempt := transferAttempt{
+		FromAccountID: req.FromAccountID,
+		Amount: req.Amount,
+		Currency: req.Currency,
+	}
+	if !server.validAccount(ctx, req.FromAccountID, attempt) {
+		return
+	}
+	toAccount, err := server.store.GetAccountByOwnerCurrency(ctx, db.GetAccountByOwnerCurrencyParams{
+		Owner: req.ToUsername,
+		Currency: req.Currency,
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err := fmt.Errorf("%w: %s has no %s account", errAccountNotFound, req.ToUsername, req.Currency)
+			ctx.JSON(http.StatusNotFound, errResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	attempt.ToAccountID = toAccount.ID
+
+	result, ok := server.transfer(ctx, attempt, transferDetails{Description: req.Description})
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+//transferDetails are the optional fields a client can attach to a transfer, empty ones are stored as NULL
+type transferDetails struct {
+	Description string
+	ClientID pgtype.UUID
+	Category string
+	ExternalReference string
+}
+
+//transfer runs TransferTx between two accounts already checked to use the attempt's currency
+//it writes the error response when the transfer fails, the caller responds on success
+//a transfer replayed by its ClientID or ExternalReference is a success too, flagged with the Idempotent-Replayed header
+func (server *Server) transfer(ctx *gin.Context, attempt transferAttempt, details transferDetails) (db.TransferTxResult, bool) {
+	if attempt.FromAccountID == attempt.ToAccountID {
+		//only known once both accounts are resolved, the sender can be given by number and the recipient by name
+		err := fmt.Errorf("account [%d] %w", attempt.FromAccountID, errSameAccount)
+		logTransferAttempt(attempt, db.TransferTxResult{}, err)
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return db.TransferTxResult{}, false
+	}
+	fee, err := server.transferFee(ctx, attempt.Currency)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return db.TransferTxResult{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return db.TransferTxResult{}, false
+	}
+
+	arg := db.TransferTxParams{
+		FromAccountID: attempt.FromAccountID,
+		ToAccountID: attempt.ToAccountID,
+		Amount: attempt.Amount,
+		Currency: attempt.Currency,
+		Description: pgtype.Text{String: details.Description, Valid: details.Description != ""},
+		Fee: fee,
+		MinimumAmount: server.config.TransferMinimum(attempt.Currency),
+		ClientID: details.ClientID,
+		Category: pgtype.Text{String: details.Category, Valid: details.Category != ""},
+		ExternalReference: pgtype.Text{String: details.ExternalReference, Valid: details.ExternalReference != ""},
+	}
+
+	result, err := server.store.TransferTx(ctx, arg)
+	logTransferAttempt(attempt, result, err)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return result, false
+		}
+		if errors.Is(err, db.ErrInsufficientBalance) {
+			ctx.JSON(http.StatusBadRequest, errResponse(err))
+			return result, false
+		}
+		if errors.Is(err, db.ErrCurrencyMismatch) {
+			//an account's currency changed after checkCurrency, answered as if the change had come first
+			ctx.JSON(http.StatusBadRequest, errResponse(err))
+			return result, false
+		}
+		if errors.Is(err, db.ErrAmountBelowMinimum) {
+			err := fmt.Errorf("%w of %s %s", err, util.FormatAmount(arg.MinimumAmount, attempt.Currency), attempt.Currency)
+			ctx.JSON(http.StatusBadRequest, errResponse(err))
+			return result, false
+		}
+		if errors.Is(err, db.ErrClientIDReused) || errors.Is(err, db.ErrExternalReferenceReused) {
+			ctx.JSON(http.StatusConflict, errResponse(err))
+			return result, false
+		}
+		if errors.Is(err, db.ErrLockTimeout) {
+			//the accounts are busy, nothing was moved and the same request can be retried shortly
+			ctx.Header("Retry-After", "1")
+			ctx.JSON(http.StatusServiceUnavailable, errResponse(db.ErrLockTimeout))
+			return result, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return result, false
+	}
+	if result.Replayed {
+		ctx.Header("Idempotent-Replayed", "true")
+	}
+	return result, true
+}
+
+//transferFee returns the configured fee for a transfer in currency
+//only transfers in the fee account's currency are charged, others get a zero fee
+func (server *Server) transferFee(ctx *gin.Context, currency string) (db.TransferFee, error) {
+	if server.config.TransferFeeAccountID == 0 {
+		return db.TransferFee{}, nil
+	}
+
+	feeAccount, err := server.store.GetAccount(ctx, server.config.TransferFeeAccountID)
+	if err != nil {
+		return db.TransferFee{}, fmt.Errorf("cannot get fee account: %w", err)
+	}
+	if feeAccount.Currency != currency {
+		return db.TransferFee{}, nil
+	}
+
+	return db.TransferFee{
+		Fixed: server.config.TransferFeeFixed,
+		BasisPoints: server.config.TransferFeeBasisPoints,
+		AccountID: feeAccount.ID,
+	}, nil
+}
+
+//getAccountOrRespond gets the account, writing the error response if it can't
+func (server *Server) getAccountOrRespond(ctx *gin.Context, accountID int64) (db.Account, bool) {
+	account, err := server.store.GetAccount(ctx, accountID)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return account, false
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return account, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return account, false
+	}
+	return account, true
+}
+
+//getAccountByNumberOrRespond gets the account with the public accountNumber, writing the error response if it can't
+func (server *Server) getAccountByNumberOrRespond(ctx *gin.Context, accountNumber string) (db.Account, bool) {
+	account, err := server.store.GetAccountByNumber(ctx, accountNumber)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return account, false
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return account, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return account, false
+	}
+	return account, true
+}
+
+//resolveAccount gets an account by its public number when one is given, by id otherwise
+func (server *Server) resolveAccount(ctx *gin.Context, accountID int64, accountNumber string) (db.Account, bool) {
+	if accountNumber != "" {
+		return server.getAccountByNumberOrRespond(ctx, accountNumber)
+	}
+	return server.getAccountOrRespond(ctx, accountID)
+}
+
+//resolveToAccount gets the transfer's recipient by id or account number, or by owner and name when neither is given
+func (server *Server) resolveToAccount(ctx *gin.Context, req transferRequest) (db.Account, bool) {
+	if req.ToName == "" {
+		return server.resolveAccount(ctx, req.ToAccountID, req.ToAccountNumber)
+	}
+
+	account, err := server.store.GetAccountByOwnerName(ctx, db.GetAccountByOwnerNameParams{
+		Owner: req.ToOwner,
+		Name: pgtype.Text{String: req.ToName, Valid: true},
+	})
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return account, false
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errAccountNotFound))
+			return account, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return account, false
+	}
+	return account, true
+}
+
+//validAccount checks that the account exists and uses the attempt's currency, writing the error response if not
+func (server *Server) validAccount(ctx *gin.Context, accountID int64, attempt transferAttempt) bool {
+	account, ok := server.getAccountOrRespond(ctx, accountID)
+	if !ok {
+		return false
+	}
+	return checkCurrency(ctx, account, attempt)
+}
+
+//checkCurrency checks that the account uses the attempt's currency, logging the attempt and writing the error response if not
+func checkCurrency(ctx *gin.Context, account db.Account, attempt transferAttempt) bool {
+	if account.Currency != attempt.Currency {
+		err := fmt.Errorf("account [%d] %w: %s vs %s", account.ID, errCurrencyMismatch, account.Currency, attempt.Currency)
+		logTransferAttempt(attempt, db.TransferTxResult{}, err)
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return false
+	}
+	return true
+}
+
+type internalTransferURI struct {
+	FromAccountID int64 `uri:"id" binding:"required,min=1"`
+	ToAccountID int64 `uri:"otherId" binding:"required,min=1,nefield=FromAccountID"`
+}
+
+type internalTransferRequest struct {
+	Amount int64 `json:"amount" binding:"required,gt=0"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+//internalTransfer moves money between two accounts of the same owner, e.g. from checking to savings
+//past the owner check it's a regular transfer, with the same fee, minimum and error responses as createTransfer
+func (server *Server) internalTransfer(ctx *gin.Context) {
+	var uri internalTransferURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	var req internalTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	fromAccount, ok := server.getAccountOrRespond(ctx, uri.FromAccountID)
+	if !ok {
+		return
+	}
+	toAccount, ok := server.getAccountOrRespond(ctx, uri.ToAccountID)
+	if !ok {
+		return
+	}
+
+	if fromAccount.Owner != toAccount.Owner {
+		err := fmt.Errorf("accounts [%d] and [%d] %w", fromAccount.ID, toAccount.ID, errDifferentOwners)
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	attempt := transferAttempt{
+		FromAccountID: fromAccount.ID,
+		ToAccountID: toAccount.ID,
+		Amount: req.Amount,
+		Currency: fromAccount.Currency,
+	}
+	if !checkCurrency(ctx, toAccount, attempt) {
+		return
+	}
+
+	result, ok := server.transfer(ctx, attempt, transferDetails{Description: req.Description})
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+type getTransferRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+//getTransfer returns any transfer by id
+//it's not limited to the parties of the transfer: there is no authenticated user to check against yet,
+//once auth lands a transfer the caller isn't party to should answer 404 like a missing one
+func (server *Server) getTransfer(ctx *gin.Context) {
+	var req getTransferRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	transfer, err := server.store.GetTransfer(ctx, req.ID)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errTransferNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+type lastAccountTransferURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+//getLastAccountTransfer returns the most recent transfer the account sent or received, 404 if it has none
+//it's a single row read, for widgets that would otherwise fetch and count a whole statement page
+//any account's last transfer can be read, ownership isn't enforced until the server has authentication
+func (server *Server) getLastAccountTransfer(ctx *gin.Context) {
+	var uri lastAccountTransferURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+
+	account, ok := server.getAccountOrRespond(ctx, uri.ID)
+	if !ok {
+		return
+	}
+
+	transfer, err := server.store.GetLastTransferByAccount(ctx, account.ID)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, db.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, errResponse(errTransferNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+type listAccountTransfersURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type listAccountTransfersRequest struct {
+	PageID int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=1"`
+	transferFilterQuery
+	dateRange
+}
+
+//transferFilterQuery narrows a statement to a status and a category, an empty param matches every transfer
+type transferFilterQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending completed failed"`
+	Category string `form:"category" binding:"max=32"`
+}
+
+func (q transferFilterQuery) status() db.NullTransferStatus {
+	return db.NullTransferStatus{TransferStatus: db.TransferStatus(q.Status), Valid: q.Status != ""}
+}
+
+func (q transferFilterQuery) category() pgtype.Text {
+	return pgtype.Text{String: q.Category, Valid: q.Category != ""}
+}
+
+//statementPeriod is how far back a statement goes when from isn't given
+const statementPeriod = 30 * 24 * time.Hour
+
+type listAccountTransfersResponse struct {
+	Transfers []db.ListTransfersWithAccountsRow `json:"transfers"`
+	Total int64 `json:"total"`
+}
+
+//listAccountTransfers returns a page of the account's statement, sent and received transfers
+//the statement covers from..to, inclusive, by default the last 30 days
+//each transfer comes with the owner and currency of both accounts, so the client needs no extra GetAccount calls
+//with Accept: application/x-ndjson the whole range is streamed instead, see streamAccountTransfers
+func (server *Server) listAccountTransfers(ctx *gin.Context) {
+	var uri listAccountTransfersURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if wantsNDJSON(ctx) {
+		server.streamAccountTransfers(ctx, uri.ID)
+		return
+	}
+	var req listAccountTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		return
+	}
+	req.PageSize = server.clampPageSize(ctx, req.PageSize)
+	from, to := req.closed(server.clock.Now(), statementPeriod)
+
+	if _, ok := server.getAccountOrRespond(ctx, uri.ID); !ok {
+		return
+	}
+
+	statement, err := server.accountStatement(ctx, uri.ID, from, to, req.transferFilterQuery, req.PageID, req.PageSize)
+	if err != nil {
+		if handleContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		return
+	}
+	setPaginationHeaders(ctx, req.PageID, req.PageSize, statement.Total)
+
+	ctx.JSON(http.StatusOK, statement)
+}
+
+//accountStatement reads one page of the account's transfers between from and to, and how many there are in total
+func (server *Server) accountStatement(ctx *gin.Context, accountID int64, from, to time.Time, filter transferFilterQuery, pageID, pageSize int32) (listAccountTransfersResponse, error) {
+	var statement listAccountTransfersResponse
+	var err error
+
+	statement.Transfers, err = server.store.ListTransfersWithAccounts(ctx, db.ListTransfersWithAccountsParams{
+		AccountID: accountID,
+		FromTime: from,
+		ToTime: to,
+		Status: filter.status(),
+		Category: filter.category(),
+		Limit: pageSize,
+		Offset: (pageID - 1) * pageSize,
+	})
+	if err != nil {
+		return statement, err
+	}
+
+	statement.Total, err = server.store.CountTransfersByAccount(ctx, db.CountTransfersByAccountParams{
+		AccountID: accountID,
+		FromTime: from,
+		ToTime: to,
+		Status: filter.status(),
+		Category: filter.category(),
+	})
+	return statement, err
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+)
+
+//transferAttempt describes a requested transfer for the audit event
+type transferAttempt struct {
+	FromAccountID int64
+	ToAccountID int64
+	Amount int64
+	Currency string
+}
+
+//transferOutcome names the result of a transfer attempt in the audit event
+func transferOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, db.ErrInsufficientBalance):
+		return "insufficient"
+	case errors.Is(err, db.ErrAmountBelowMinimum):
+		return "below_minimum"
+	case errors.Is(err, db.ErrLockTimeout):
+		return "lock_timeout"
+	case errors.Is(err, errCurrencyMismatch), errors.Is(err, db.ErrCurrencyMismatch):
+		return "mismatch"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "error"
+}
+
+//logTransferAttempt emits one structured event per transfer attempt, the fraud detection pipeline consumes them
+//balances are only known, and only logged, when the transfer succeeded
+func logTransferAttempt(attempt transferAttempt, result db.TransferTxResult, err error) {
+	attrs := []any{
+		"from_account_id", attempt.FromAccountID,
+		"to_account_id", attempt.ToAccountID,
+		"amount", attempt.Amount,
+		"currency", attempt.Currency,
+		"result", transferOutcome(err),
+	}
+	if err == nil {
+		attrs = append(attrs,
+			"transfer_id", result.Transfer.ID,
+			"from_balance", result.FromAccount.Balance,
+			"to_balance", result.ToAccount.Balance,
+		)
+	} else {
+		attrs = append(attrs, "error", err.Error())
+	}
+	slog.Info("transfer attempt", attrs...)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogTransferAttempt(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	attempt := transferAttempt{FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD"}
+	result := db.TransferTxResult{
+		Transfer: db.Transfer{ID: 7},
+		FromAccount: db.Account{ID: 1, Balance: 90},
+		ToAccount: db.Account{ID: 2, Balance: 110},
+	}
+
+	testCases := []struct {
+		name string
+		err error
+		want map[string]any
+	}{
+		{
+			name: "Success",
+			want: map[string]any{"result": "success", "transfer_id": 7.0, "from_balance": 90.0, "to_balance": 110.0},
+		},
+		{
+			name: "Insufficient",
+			err: db.ErrInsufficientBalance,
+			want: map[string]any{"result": "insufficient"},
+		},
+		{
+			name: "LockTimeout",
+			err: db.ErrLockTimeout,
+			want: map[string]any{"result": "lock_timeout"},
+		},
+		{
+			name: "Mismatch",
+			err: fmt.Errorf("account [2] %w: EUR vs USD", errCurrencyMismatch),
+			want: map[string]any{"result": "mismatch"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			logTransferAttempt(attempt, result, tc.err)
+
+			var event map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+			require.Equal(t, "transfer attempt", event["msg"])
+			require.Equal(t, 1.0, event["from_account_id"])
+			require.Equal(t, 2.0, event["to_account_id"])
+			require.Equal(t, 10.0, event["amount"])
+			require.Equal(t, "USD", event["currency"])
+			for key, value := range tc.want {
+				require.Equal(t, value, event[key], key)
+			}
+			if tc.err != nil {
+				require.NotContains(t, event, "from_balance")
+			}
+		})
+	}
+}
@@ -0,0 +1,1207 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mockdb "github.com/TriNgoc2077/Simple-Bank/db/mock"
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/db/testutil"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCreateTransferAPI(t *testing.T) {
+	amount := int64(150)
+
+	account1 := randomAccount("USD")
+	account1.Balance = 100
+	account2 := randomAccount("USD")
+	account2.ID = account1.ID + 1
+	account3 := randomAccount("EUR")
+	account3.ID = account1.ID + 2
+
+	testCases := []struct {
+		name string
+		body gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID: account2.ID,
+					Amount: 10,
+					Currency: "USD",
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "AmountDecimal",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount_decimal": "0.25",
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID: account2.ID,
+					Amount: 25,
+					Currency: "USD",
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "AmountDecimalTooPrecise",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount_decimal": "1.5",
+				"currency": util.JPY,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "AmountDecimalZero",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount_decimal": "0.00",
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "AmountAndAmountDecimal",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": 25,
+				"amount_decimal": "0.25",
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InsufficientBalance",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": amount,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrInsufficientBalance)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyError(t, recorder, db.ErrInsufficientBalance.Error())
+				requireBodyCode(t, recorder, codeInsufficientBalance)
+			},
+		},
+		{
+			name: "LockTimeout",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": amount,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.TransferTxResult{}, fmt.Errorf("%w: ERROR: canceling statement due to lock timeout (SQLSTATE 55P03)", db.ErrLockTimeout))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, "1", recorder.Header().Get("Retry-After"))
+				//the postgres details stay in the log
+				requireBodyError(t, recorder, db.ErrLockTimeout.Error())
+				requireBodyCode(t, recorder, codeLockTimeout)
+			},
+		},
+		{
+			name: "CurrencyChanged",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": amount,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				//account2 was relabelled between the handler's check and TransferTx
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.TransferTxResult{}, fmt.Errorf("account [%d] %w: EUR vs USD", account2.ID, db.ErrCurrencyMismatch))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeCurrencyMismatch)
+			},
+		},
+		{
+			name: "FromAccountNotFound",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": amount,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountNotFound)
+			},
+		},
+		{
+			name: "ToAccountByName",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_owner": account2.Owner,
+				"to_name": "savings",
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccountByOwnerName(gomock.Any(), gomock.Eq(db.GetAccountByOwnerNameParams{
+					Owner: account2.Owner,
+					Name: pgtype.Text{String: "savings", Valid: true},
+				})).Times(1).Return(account2, nil)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID: account2.ID,
+					Amount: 10,
+					Currency: "USD",
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "ToAccountByIDAndName",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"to_owner": account2.Owner,
+				"to_name": "savings",
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "ByAccountNumber",
+			body: gin.H{
+				"from_account_number": account1.AccountNumber,
+				"to_account_number": account2.AccountNumber,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Eq(account1.AccountNumber)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Eq(account2.AccountNumber)).Times(1).Return(account2, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID: account2.ID,
+					Amount: 10,
+					Currency: "USD",
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "FromAccountByIDAndNumber",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"from_account_number": account1.AccountNumber,
+				"to_account_id": account2.ID,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetAccountByNumber(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "CurrencyMismatch",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": 10,
+				"currency": "EUR",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeCurrencyMismatch)
+			},
+		},
+		{
+			name: "ToAccountCurrencyMismatch",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account3.ID,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeCurrencyMismatch)
+				requireBodyError(t, recorder, fmt.Sprintf("account [%d] currency mismatch: EUR vs USD", account3.ID))
+			},
+		},
+		{
+			name: "SameAccount",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account1.ID,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(2).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+				requireBodyError(t, recorder, fmt.Sprintf("account [%d] cannot transfer to itself", account1.ID))
+			},
+		},
+		{
+			name: "InvalidAmount",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id": account2.ID,
+				"amount": -1,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func randomAccount(currency string) db.Account {
+	return db.Account{
+		ID: util.RandomInt(1, 1000),
+		Owner: util.RandomOwner(),
+		Balance: util.RandomMoney(),
+		Currency: currency,
+		AccountNumber: fmt.Sprintf("%012d", util.RandomInt(0, 999999999999)),
+		//the column default, nil would come back from JSON as null
+		Metadata: json.RawMessage(`{}`),
+	}
+}
+
+func requireBodyError(t *testing.T, recorder *httptest.ResponseRecorder, message string) {
+	var body gin.H
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	require.NoError(t, err)
+	require.Equal(t, message, body["error"])
+}
+
+func requireBodyCode(t *testing.T, recorder *httptest.ResponseRecorder, code string) {
+	var body gin.H
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	require.NoError(t, err)
+	require.Equal(t, code, body["code"])
+}
+
+func TestCreateTransferByUsernameAPI(t *testing.T) {
+	account1 := randomAccount("USD")
+	account2 := randomAccount("USD")
+	account2.ID = account1.ID + 1
+
+	testCases := []struct {
+		name string
+		body gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_username": account2.Owner,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccountByOwnerCurrency(gomock.Any(), gomock.Eq(db.GetAccountByOwnerCurrencyParams{
+					Owner: account2.Owner,
+					Currency: "USD",
+				})).Times(1).Return(account2, nil)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID: account2.ID,
+					Amount: 10,
+					Currency: "USD",
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "RecipientHasNoAccountInCurrency",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_username": account2.Owner,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccountByOwnerCurrency(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountNotFound)
+			},
+		},
+		{
+			name: "OwnAccount",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_username": account1.Owner,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccountByOwnerCurrency(gomock.Any(), gomock.Any()).Times(1).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+		{
+			name: "MissingUsername",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"amount": 10,
+				"currency": "USD",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transfers/by-username", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListAccountTransfersAPI(t *testing.T) {
+	account := randomAccount("USD")
+	other := randomAccount("USD")
+	other.ID = account.ID + 1
+	from := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.March, 31, 23, 59, 59, 0, time.UTC)
+	rows := []db.ListTransfersWithAccountsRow{
+		{
+			Transfer: db.Transfer{ID: 1, FromAccountID: account.ID, ToAccountID: other.ID, Amount: 10, Status: db.TransferStatusCompleted},
+			FromOwner: account.Owner,
+			FromCurrency: account.Currency,
+			ToOwner: other.Owner,
+			ToCurrency: other.Currency,
+		},
+	}
+
+	testCases := []struct {
+		name string
+		query string
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: fmt.Sprintf("page_id=1&page_size=5&status=completed&from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				status := db.NullTransferStatus{TransferStatus: db.TransferStatusCompleted, Valid: true}
+				store.EXPECT().ListTransfersWithAccounts(gomock.Any(), gomock.Eq(db.ListTransfersWithAccountsParams{
+					AccountID: account.ID,
+					FromTime: from,
+					ToTime: to,
+					Status: status,
+					Limit: 5,
+				})).Times(1).Return(rows, nil)
+				store.EXPECT().CountTransfersByAccount(gomock.Any(), gomock.Eq(db.CountTransfersByAccountParams{
+					AccountID: account.ID,
+					FromTime: from,
+					ToTime: to,
+					Status: status,
+				})).Times(1).Return(int64(1), nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(other.ID)).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "1", recorder.Header().Get("X-Total-Count"))
+
+				var body listAccountTransfersResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, rows, body.Transfers)
+			},
+		},
+		{
+			name: "DefaultLast30Days",
+			query: "page_id=1&page_size=5",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				store.EXPECT().ListTransfersWithAccounts(gomock.Any(), gomock.Eq(db.ListTransfersWithAccountsParams{
+					AccountID: account.ID,
+					FromTime: to.Add(-30 * 24 * time.Hour),
+					ToTime: to,
+					Limit: 5,
+				})).Times(1).Return(rows, nil)
+				store.EXPECT().CountTransfersByAccount(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "FromAfterTo",
+			query: fmt.Sprintf("page_id=1&page_size=5&from=%s&to=%s", to.Format(time.RFC3339), from.Format(time.RFC3339)),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListTransfersWithAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "AccountNotFound",
+			query: "page_id=1&page_size=5",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().ListTransfersWithAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidStatus",
+			query: "page_id=1&page_size=5&status=done",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.clock = &util.FixedClock{T: to}
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/transfers?%s", account.ID, tc.query)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+//TestCreateTransferAPIEndToEnd runs the handler against the in-memory store, so balances are really checked
+func TestCreateTransferAPIEndToEnd(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(currency string, balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: currency,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(util.USD, 100)
+	account2 := newAccount(util.USD, 0)
+	account3 := newAccount(util.EUR, 0)
+	server := newTestServer(t, store)
+
+	post := func(body gin.H) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := post(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": 70, "currency": util.USD})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = post(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": 70, "currency": util.USD})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInsufficientBalance)
+
+	recorder = post(gin.H{"from_account_id": account1.ID, "to_account_id": account3.ID, "amount": 10, "currency": util.USD})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeCurrencyMismatch)
+
+	account1, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	account2, err = store.GetAccount(ctx, account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(30), account1.Balance)
+	require.Equal(t, int64(70), account2.Balance)
+}
+
+func TestCreateTransferReturnStatementAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(100)
+	account2 := newAccount(0)
+	server := newTestServer(t, store)
+
+	post := func(query string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": 10, "currency": util.USD})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers?"+query, bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//off by default
+	recorder := post("")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotContains(t, recorder.Body.String(), `"statement"`)
+
+	recorder = post("return_statement=true")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var body transferWithStatementResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, int64(80), body.FromAccount.Balance)
+	require.NotNil(t, body.Statement)
+	require.Equal(t, int64(2), body.Statement.Total)
+	require.Len(t, body.Statement.Transfers, 2)
+
+	recorder = post("return_statement=maybe")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestCreateTransferClientIDAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(100)
+	account2 := newAccount(0)
+	server := newTestServer(t, store)
+
+	post := func(clientID string, amount int64) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.USD, "client_id": clientID})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	clientID := "0b7e5a1c-3f2d-4c8e-9a6b-1d2e3f4a5b6c"
+
+	recorder := post(clientID, 10)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Idempotent-Replayed"))
+	var first db.TransferTxResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &first))
+
+	//the retry returns the same transfer and moves nothing
+	recorder = post(clientID, 10)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "true", recorder.Header().Get("Idempotent-Replayed"))
+	var second db.TransferTxResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &second))
+	require.Equal(t, first.Transfer.ID, second.Transfer.ID)
+	require.Equal(t, int64(90), second.FromAccount.Balance)
+
+	recorder = post(clientID, 20)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyCode(t, recorder, codeClientIDReused)
+
+	recorder = post("not-a-uuid", 10)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInvalidRequest)
+}
+
+func TestCreateTransferExternalReferenceAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(100)
+	account2 := newAccount(100)
+	server := newTestServer(t, store)
+
+	post := func(from, to db.Account, reference string, amount int64) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"from_account_id": from.ID, "to_account_id": to.ID, "amount": amount, "currency": util.USD, "external_reference": reference})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := post(account1, account2, "INV-1001", 10)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var first db.TransferTxResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &first))
+	require.Equal(t, "INV-1001", first.Transfer.ExternalReference.String)
+
+	//a duplicate reference is a replay, not a conflict
+	recorder = post(account1, account2, "INV-1001", 10)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "true", recorder.Header().Get("Idempotent-Replayed"))
+	var second db.TransferTxResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &second))
+	require.Equal(t, first.Transfer.ID, second.Transfer.ID)
+	require.Equal(t, int64(90), second.FromAccount.Balance)
+
+	recorder = post(account1, account2, "INV-1001", 20)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyCode(t, recorder, codeExternalReferenceReused)
+
+	//references are per sending account
+	recorder = post(account2, account1, "INV-1001", 10)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Idempotent-Replayed"))
+
+	recorder = post(account1, account2, strings.Repeat("x", 65), 10)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInvalidRequest)
+}
+
+func TestCreateTransferMinimumAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(1000)
+	account2 := newAccount(0)
+	server := NewServer(util.Config{EnableTransfers: true, TransferMinimums: []string{"USD:100"}}, store)
+
+	post := func(amount int64) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.USD})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := post(99)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeAmountBelowMinimum)
+	requireBodyError(t, recorder, "amount below the minimum transfer amount of 1.00 USD")
+
+	recorder = post(100)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestTransferCategoryAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(1000)
+	account2 := newAccount(0)
+	server := NewServer(util.Config{EnableTransfers: true, TransferCategories: []string{"groceries", "rent"}}, store)
+
+	post := func(category string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": 10, "currency": util.USD, "category": category})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	list := func(category string) listAccountTransfersResponse {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/transfers?page_id=1&page_size=10&category=%s", account1.ID, category), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var statement listAccountTransfersResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &statement))
+		return statement
+	}
+
+	recorder := post("groceries")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var result db.TransferTxResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.Equal(t, pgtype.Text{String: "groceries", Valid: true}, result.Transfer.Category)
+
+	require.Equal(t, http.StatusOK, post("rent").Code)
+	require.Equal(t, http.StatusOK, post("").Code)
+
+	recorder = post("travel")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyCode(t, recorder, codeInvalidRequest)
+
+	statement := list("groceries")
+	require.Equal(t, int64(1), statement.Total)
+	require.Len(t, statement.Transfers, 1)
+	require.Equal(t, "groceries", statement.Transfers[0].Transfer.Category.String)
+
+	require.Equal(t, int64(3), list("").Total)
+	require.Zero(t, list("travel").Total)
+}
+
+func TestGetLastAccountTransferAPI(t *testing.T) {
+	store := testutil.NewStore()
+	ctx := context.Background()
+	newAccount := func(balance int64) db.Account {
+		result, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(1000)
+	account2 := newAccount(1000)
+	account3 := newAccount(0)
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+	require.NoError(t, err)
+	last, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 20})
+	require.NoError(t, err)
+	server := newTestServer(t, store)
+
+	get := func(accountID int64) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d/last-transfer", accountID), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//sent or received, the latest one counts
+	for _, account := range []db.Account{account1, account2} {
+		recorder := get(account.ID)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var got db.Transfer
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+		require.Equal(t, last.Transfer, got)
+	}
+
+	recorder := get(account3.ID)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireBodyCode(t, recorder, codeTransferNotFound)
+
+	recorder = get(account3.ID + 1000)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireBodyCode(t, recorder, codeAccountNotFound)
+}
+
+func TestInternalTransferAPI(t *testing.T) {
+	checking := randomAccount("USD")
+	savings := randomAccount("USD")
+	savings.ID = checking.ID + 1
+	savings.Owner = checking.Owner
+	other := randomAccount("USD")
+	other.ID = checking.ID + 2
+	euros := randomAccount("EUR")
+	euros.ID = checking.ID + 3
+	euros.Owner = checking.Owner
+
+	testCases := []struct {
+		name string
+		toAccountID int64
+		body gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10, "description": "rainy day"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(savings, nil)
+				arg := db.TransferTxParams{
+					FromAccountID: checking.ID,
+					ToAccountID: savings.ID,
+					Amount: 10,
+					Currency: "USD",
+					Description: pgtype.Text{String: "rainy day", Valid: true},
+					MinimumAmount: 1,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyCode(t, recorder, codeAccountNotFound)
+			},
+		},
+		{
+			name: "DifferentOwners",
+			toAccountID: other.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(other.ID)).Times(1).Return(other, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeDifferentOwners)
+			},
+		},
+		{
+			name: "CurrencyMismatch",
+			toAccountID: euros.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(euros.ID)).Times(1).Return(euros, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeCurrencyMismatch)
+			},
+		},
+		{
+			name: "InsufficientBalance",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(savings, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrInsufficientBalance)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInsufficientBalance)
+			},
+		},
+		{
+			name: "BelowMinimum",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(savings, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrAmountBelowMinimum)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeAmountBelowMinimum)
+			},
+		},
+		{
+			name: "LockTimeout",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(savings, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrLockTimeout)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, "1", recorder.Header().Get("Retry-After"))
+				requireBodyCode(t, recorder, codeLockTimeout)
+			},
+		},
+		{
+			name: "InternalError",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(checking, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(savings.ID)).Times(1).Return(savings, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, errors.New("connection reset"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireBodyCode(t, recorder, codeInternal)
+			},
+		},
+		{
+			name: "DeadlineExceeded",
+			toAccountID: savings.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(checking.ID)).Times(1).Return(db.Account{}, context.DeadlineExceeded)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				requireBodyCode(t, recorder, codeTimeout)
+			},
+		},
+		{
+			name: "SameAccount",
+			toAccountID: checking.ID,
+			body: gin.H{"amount": 10},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyCode(t, recorder, codeInvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/accounts/%d/transfer-to/%d", checking.ID, tc.toAccountID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
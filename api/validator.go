@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/go-playground/validator/v10"
+)
+
+//validCurrency backs the currency binding tag with util's supported currencies
+var validCurrency validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if currency, ok := fieldLevel.Field().Interface().(string); ok {
+		return util.IsSupportedCurrency(currency)
+	}
+	return false
+}
+
+//validAccountNumber backs the account_number binding tag
+var validAccountNumber validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if accountNumber, ok := fieldLevel.Field().Interface().(string); ok {
+		return util.IsAccountNumber(accountNumber)
+	}
+	return false
+}
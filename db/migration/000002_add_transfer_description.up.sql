@@ -0,0 +1,3 @@
+ALTER TABLE "transfers" ADD COLUMN "description" varchar;
+
+COMMENT ON COLUMN "transfers"."description" IS 'optional note from the sender';
@@ -0,0 +1,3 @@
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "status";
+
+DROP TYPE IF EXISTS "transfer_status";
@@ -0,0 +1,5 @@
+CREATE TYPE "transfer_status" AS ENUM ('pending', 'completed', 'failed');
+
+ALTER TABLE "transfers" ADD COLUMN "status" transfer_status NOT NULL DEFAULT 'completed';
+
+COMMENT ON COLUMN "transfers"."status" IS 'pending transfers can move to completed or failed';
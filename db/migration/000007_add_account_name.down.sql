@@ -0,0 +1,3 @@
+ALTER TABLE "accounts" DROP CONSTRAINT IF EXISTS "owner_name_key";
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "name";
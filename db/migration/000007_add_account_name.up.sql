@@ -0,0 +1,3 @@
+ALTER TABLE "accounts" ADD COLUMN "name" varchar;
+
+ALTER TABLE "accounts" ADD CONSTRAINT "owner_name_key" UNIQUE ("owner", "name");
@@ -0,0 +1,3 @@
+ALTER TABLE "accounts" ADD COLUMN "updated_at" timestamp NOT NULL DEFAULT (now());
+
+UPDATE "accounts" SET "updated_at" = "created_at";
@@ -0,0 +1,9 @@
+CREATE TABLE "events" (
+  "id" bigserial PRIMARY KEY,
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now()),
+  "processed_at" timestamp
+);
+
+CREATE INDEX ON "events" ("id") WHERE "processed_at" IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE "accounts" DROP CONSTRAINT IF EXISTS "account_number_key";
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "account_number";
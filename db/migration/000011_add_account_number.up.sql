@@ -0,0 +1,7 @@
+-- a volatile default is evaluated per row, so existing accounts get their own number too
+ALTER TABLE "accounts" ADD COLUMN "account_number" varchar NOT NULL
+  DEFAULT lpad(floor(random() * 1000000000000)::bigint::text, 12, '0');
+
+ALTER TABLE "accounts" ADD CONSTRAINT "account_number_key" UNIQUE ("account_number");
+
+COMMENT ON COLUMN "accounts"."account_number" IS 'public identifier given to clients, joins keep using id';
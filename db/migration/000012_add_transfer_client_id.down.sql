@@ -0,0 +1,3 @@
+ALTER TABLE "transfers" DROP CONSTRAINT IF EXISTS "transfer_client_id_key";
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "client_id";
@@ -0,0 +1,6 @@
+ALTER TABLE "transfers" ADD COLUMN "client_id" uuid;
+
+-- NULLs never conflict, so only transfers created with a client id are deduplicated
+ALTER TABLE "transfers" ADD CONSTRAINT "transfer_client_id_key" UNIQUE ("client_id");
+
+COMMENT ON COLUMN "transfers"."client_id" IS 'client supplied id, a retried insert returns the existing transfer';
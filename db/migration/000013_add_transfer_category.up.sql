@@ -0,0 +1,3 @@
+ALTER TABLE "transfers" ADD COLUMN "category" varchar(32);
+
+COMMENT ON COLUMN "transfers"."category" IS 'optional label for budgeting, filterable on the account statement';
@@ -0,0 +1,3 @@
+ALTER TABLE "transfers" DROP CONSTRAINT IF EXISTS "transfer_from_account_external_reference_key";
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "external_reference";
@@ -0,0 +1,7 @@
+ALTER TABLE "transfers" ADD COLUMN "external_reference" varchar(64);
+
+-- references are the sender's own ids, so they only need to be unique per sending account
+-- NULLs never conflict, so only transfers created with a reference are deduplicated
+ALTER TABLE "transfers" ADD CONSTRAINT "transfer_from_account_external_reference_key" UNIQUE ("from_account_id", "external_reference");
+
+COMMENT ON COLUMN "transfers"."external_reference" IS 'client supplied reference for reconciliation, unique per sending account';
@@ -0,0 +1,3 @@
+ALTER TABLE "accounts" DROP CONSTRAINT IF EXISTS "account_metadata_object";
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "metadata";
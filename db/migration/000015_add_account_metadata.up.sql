@@ -0,0 +1,5 @@
+ALTER TABLE "accounts" ADD COLUMN "metadata" jsonb NOT NULL DEFAULT '{}';
+
+ALTER TABLE "accounts" ADD CONSTRAINT "account_metadata_object" CHECK (jsonb_typeof("metadata") = 'object');
+
+COMMENT ON COLUMN "accounts"."metadata" IS 'free-form client labels, always a JSON object';
@@ -0,0 +1,9 @@
+CREATE TABLE "balance_snapshots" (
+  "account_id" bigint NOT NULL REFERENCES "accounts" ("id") ON DELETE CASCADE,
+  "snapshot_date" date NOT NULL,
+  "balance" bigint NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("account_id", "snapshot_date")
+);
+
+COMMENT ON COLUMN "balance_snapshots"."balance" IS 'balance at the end of snapshot_date';
@@ -0,0 +1 @@
+ALTER TABLE "transfers" DROP CONSTRAINT IF EXISTS "transfer_distinct_accounts";
@@ -0,0 +1 @@
+ALTER TABLE "transfers" ADD CONSTRAINT "transfer_distinct_accounts" CHECK ("from_account_id" <> "to_account_id");
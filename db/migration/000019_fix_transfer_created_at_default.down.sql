@@ -0,0 +1 @@
+ALTER TABLE "transfers" ALTER COLUMN "created_at" SET DEFAULT 'now()';
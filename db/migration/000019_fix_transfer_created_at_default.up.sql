@@ -0,0 +1,3 @@
+-- the init schema set the default to the literal 'now()', which postgres evaluated once at CREATE TABLE,
+-- so every transfer got the schema's creation time; rows written before this keep that timestamp
+ALTER TABLE "transfers" ALTER COLUMN "created_at" SET DEFAULT now();
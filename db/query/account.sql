@@ -1,8 +1,8 @@
 -- name: CreateAccount :one
 INSERT INTO accounts (
-  owner, balance, currency
+  owner, balance, currency, name
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4
 )
 RETURNING *;
 
@@ -10,29 +10,100 @@ RETURNING *;
 SELECT * FROM accounts
 WHERE id = $1 LIMIT 1;
 
+-- name: GetAccountByNumber :one
+SELECT * FROM accounts
+WHERE account_number = $1 LIMIT 1;
+
+-- name: GetAccountByOwnerName :one
+SELECT * FROM accounts
+WHERE owner = $1 AND name = $2 LIMIT 1;
+
+-- name: GetAccountByOwnerCurrency :one
+SELECT * FROM accounts
+WHERE owner = $1 AND currency = $2 LIMIT 1;
+
 -- name: GetAccountForUpdate :one
 SELECT * FROM accounts
 WHERE id = $1 LIMIT 1
 FOR NO KEY UPDATE;
 
+-- name: ListAccountsByIDs :many
+SELECT * FROM accounts
+WHERE id = ANY(sqlc.arg(ids)::bigint[])
+  AND (sqlc.narg(owner)::varchar IS NULL OR owner = sqlc.narg(owner))
+ORDER BY id;
+
 -- name: ListAccounts :many
 SELECT * FROM accounts
-ORDER BY id
-LIMIT $1
-OFFSET $2;
+WHERE (sqlc.narg(owner)::varchar IS NULL OR owner = sqlc.narg(owner))
+  AND (sqlc.narg(currency)::varchar IS NULL OR currency = sqlc.narg(currency))
+ORDER BY
+  CASE WHEN sqlc.arg(sort_by)::text = 'created_at' THEN created_at END,
+  id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: CountAccounts :one
+SELECT COUNT(*) FROM accounts
+WHERE (sqlc.narg(owner)::varchar IS NULL OR owner = sqlc.narg(owner))
+  AND (sqlc.narg(currency)::varchar IS NULL OR currency = sqlc.narg(currency));
 
 -- name: UpdateAccount :one
 UPDATE accounts
-SET balance = $2
+SET balance = $2, updated_at = now()
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateAccountName :one
+UPDATE accounts
+SET name = sqlc.narg(name), updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetAccountMetadata :one
+SELECT metadata FROM accounts
+WHERE id = $1 LIMIT 1;
+
+-- name: SetAccountMetadata :one
+UPDATE accounts
+SET metadata = sqlc.arg(metadata), updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateAccountCurrency :one
+UPDATE accounts
+SET currency = sqlc.arg(currency), updated_at = now()
+WHERE accounts.id = sqlc.arg(id)
+  AND accounts.balance = 0
+  AND NOT EXISTS (
+    SELECT 1 FROM transfers
+    WHERE transfers.from_account_id = accounts.id OR transfers.to_account_id = accounts.id
+  )
+RETURNING *;
+
 -- name: AddAccountBalance :one
 UPDATE accounts
-SET balance = balance + sqlc.arg(amount)
+SET balance = balance + sqlc.arg(amount), updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: AddAccountHeldBalance :one
+UPDATE accounts
+SET held_balance = held_balance + sqlc.arg(amount), updated_at = now()
 WHERE id = sqlc.arg(id)
 RETURNING *;
 
 -- name: DeleteAccount :exec
 DELETE FROM accounts
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: ListAccountBalanceDrift :many
+SELECT
+  accounts.id,
+  accounts.balance,
+  COALESCE(SUM(entries.amount), 0)::bigint AS entries_total
+FROM accounts
+LEFT JOIN entries ON entries.account_id = accounts.id
+GROUP BY accounts.id
+HAVING accounts.balance <> COALESCE(SUM(entries.amount), 0)
+ORDER BY accounts.id;
@@ -0,0 +1,24 @@
+-- name: CreateBalanceSnapshots :execrows
+-- the job may run well after midnight, so the balance is rolled back by the entries made since the day ended
+-- one statement reads one snapshot, balances and entries always agree
+-- taking the same day again changes nothing
+INSERT INTO balance_snapshots (account_id, snapshot_date, balance)
+SELECT
+  accounts.id,
+  sqlc.arg(snapshot_date)::date,
+  accounts.balance - COALESCE((
+    SELECT SUM(entries.amount) FROM entries
+    WHERE entries.account_id = accounts.id
+      AND entries.created_at >= sqlc.arg(snapshot_date)::date + 1
+  ), 0)::bigint
+FROM accounts
+WHERE accounts.created_at < sqlc.arg(snapshot_date)::date + 1
+ON CONFLICT (account_id, snapshot_date) DO NOTHING;
+
+-- name: GetBalanceSnapshotAsOf :one
+-- the latest snapshot on or before as_of, its snapshot_date says which day it is for
+SELECT * FROM balance_snapshots
+WHERE account_id = sqlc.arg(account_id)
+  AND snapshot_date <= sqlc.arg(as_of)::date
+ORDER BY snapshot_date DESC
+LIMIT 1;
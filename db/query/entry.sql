@@ -1,8 +1,8 @@
 -- name: CreateEntry :one
 INSERT INTO entries (
-  account_id, amount
+  account_id, amount, transfer_id
 ) VALUES (
-    $1, $2
+    $1, $2, $3
 )
 RETURNING *;
 
@@ -16,6 +16,27 @@ ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: ListEntriesByAccount :many
+SELECT * FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND (sqlc.narg(from_time)::timestamp IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamp IS NULL OR created_at <= sqlc.narg(to_time))
+  AND (sqlc.narg(sign)::text IS NULL
+    OR (sqlc.narg(sign) = 'positive' AND amount > 0)
+    OR (sqlc.narg(sign) = 'negative' AND amount < 0))
+ORDER BY id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: CountEntriesByAccount :one
+SELECT COUNT(*) FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND (sqlc.narg(from_time)::timestamp IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamp IS NULL OR created_at <= sqlc.narg(to_time))
+  AND (sqlc.narg(sign)::text IS NULL
+    OR (sqlc.narg(sign) = 'positive' AND amount > 0)
+    OR (sqlc.narg(sign) = 'negative' AND amount < 0));
+
 -- name: UpdateEntry :one
 UPDATE entries
   set amount = $2
@@ -25,3 +46,12 @@ RETURNING *;
 -- name: DeleteEntry :exec
 DELETE FROM entries
 WHERE id = $1;
+
+-- name: GetEntryTotals :one
+SELECT
+  COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0)::bigint AS total_deposited,
+  COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0)::bigint AS total_withdrawn
+FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND (sqlc.narg(from_time)::timestamp IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamp IS NULL OR created_at <= sqlc.narg(to_time));
@@ -0,0 +1,19 @@
+-- name: CreateEvent :one
+INSERT INTO events (
+  event_type, payload
+) VALUES (
+  $1, $2
+)
+RETURNING *;
+
+-- name: ListUnprocessedEvents :many
+SELECT * FROM events
+WHERE processed_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkEventProcessed :exec
+UPDATE events
+SET processed_at = now()
+WHERE id = $1;
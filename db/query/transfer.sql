@@ -1,21 +1,90 @@
 -- name: CreateTransfer :one
 INSERT INTO transfers (
-  from_account_id, to_account_id, amount
+  from_account_id, to_account_id, amount, description, fee, status, client_id, category, external_reference
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
+-- no target, so a taken client id and a taken external reference both return no row
+ON CONFLICT DO NOTHING
 RETURNING *;
 
 -- name: GetTransfer :one
 SELECT * FROM transfers
 WHERE id = $1 LIMIT 1;
 
+-- name: GetTransferByClientID :one
+SELECT * FROM transfers
+WHERE client_id = $1 LIMIT 1;
+
+-- name: GetTransferByExternalReference :one
+SELECT * FROM transfers
+WHERE from_account_id = $1 AND external_reference = $2 LIMIT 1;
+
+-- name: GetLastTransferByAccount :one
+SELECT * FROM transfers
+WHERE from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id)
+ORDER BY created_at DESC, id DESC
+LIMIT 1;
+
 -- name: ListTransfer :many
 SELECT * FROM transfers
 ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: ListTransfersByAccount :many
+SELECT * FROM transfers
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+  AND (sqlc.narg(status)::transfer_status IS NULL OR status = sqlc.narg(status))
+  AND (sqlc.narg(category)::varchar IS NULL OR category = sqlc.narg(category))
+ORDER BY id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: CountTransfersByAccount :one
+SELECT COUNT(*) FROM transfers
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+  AND (sqlc.narg(status)::transfer_status IS NULL OR status = sqlc.narg(status))
+  AND (sqlc.narg(category)::varchar IS NULL OR category = sqlc.narg(category));
+
+-- name: GetTransferWithAccounts :one
+SELECT
+  sqlc.embed(transfers),
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE transfers.id = $1 LIMIT 1;
+
+-- name: ListTransfersWithAccounts :many
+SELECT
+  sqlc.embed(transfers),
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = sqlc.arg(account_id) OR transfers.to_account_id = sqlc.arg(account_id))
+  AND transfers.created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+  AND (sqlc.narg(status)::transfer_status IS NULL OR transfers.status = sqlc.narg(status))
+  AND (sqlc.narg(category)::varchar IS NULL OR transfers.category = sqlc.narg(category))
+ORDER BY transfers.id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: UpdateTransferStatus :one
+UPDATE transfers
+SET status = sqlc.arg(status)
+WHERE id = sqlc.arg(id) AND status = 'pending'
+RETURNING *;
+
 -- name: ListTransferFromAccount :many
 SELECT * FROM transfers
 ORDER BY from_account_id = $1, to_account_id = $1
@@ -26,4 +95,74 @@ OFFSET $3;
 SELECT * FROM transfers
 WHERE (from_account_id = $1 AND to_account_id = $2)
    OR (from_account_id = $2 AND to_account_id = $1)
-LIMIT $3 OFFSET $4;
\ No newline at end of file
+LIMIT $3 OFFSET $4;
+
+-- name: CountAccountTransfers :one
+SELECT
+  COUNT(*) FILTER (WHERE from_account_id = sqlc.arg(account_id)) AS sent,
+  COUNT(*) FILTER (WHERE to_account_id = sqlc.arg(account_id)) AS received
+FROM transfers
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND (sqlc.narg(from_time)::timestamp IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamp IS NULL OR created_at <= sqlc.narg(to_time));
+
+-- name: ListStatementTransfers :many
+-- every transfer of the account in the range with both accounts, oldest first, StreamStatementTransfers reads it without buffering
+SELECT
+  sqlc.embed(transfers),
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = sqlc.arg(account_id) OR transfers.to_account_id = sqlc.arg(account_id))
+  AND transfers.created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+  AND (sqlc.narg(status)::transfer_status IS NULL OR transfers.status = sqlc.narg(status))
+  AND (sqlc.narg(category)::varchar IS NULL OR transfers.category = sqlc.narg(category))
+ORDER BY transfers.created_at, transfers.id;
+
+-- name: ListStatementLines :many
+-- the CSV statement: every completed transfer of the account in the range, plus its opening balance
+-- and the fees it collected on other accounts' transfers, oldest first
+-- amount is the signed change to the account's balance, StreamStatementLines reads it without buffering
+-- pending and failed transfers never moved money, so they are left out
+-- the opening balance is the entry written in the account's own transaction, which shares its now(),
+-- other entries without a transfer_id predate the column and are already covered by their transfer's line
+SELECT
+  'transfer'::varchar AS kind,
+  transfers.id AS transfer_id,
+  0::bigint AS entry_id,
+  transfers.created_at,
+  (CASE WHEN transfers.from_account_id = sqlc.arg(account_id) THEN -(transfers.amount + transfers.fee) ELSE transfers.amount END)::bigint AS amount,
+  transfers.fee,
+  (CASE WHEN transfers.from_account_id = sqlc.arg(account_id) THEN to_account.account_number ELSE from_account.account_number END)::varchar AS counterparty_account_number,
+  COALESCE(transfers.description, '')::varchar AS description,
+  COALESCE(transfers.category, '')::varchar AS category
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = sqlc.arg(account_id) OR transfers.to_account_id = sqlc.arg(account_id))
+  AND transfers.status = 'completed'
+  AND transfers.created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+UNION ALL
+SELECT
+  (CASE WHEN entries.transfer_id IS NULL THEN 'opening_balance' ELSE 'fee' END)::varchar AS kind,
+  COALESCE(entries.transfer_id, 0)::bigint AS transfer_id,
+  entries.id AS entry_id,
+  entries.created_at,
+  entries.amount,
+  0::bigint AS fee,
+  COALESCE(payer.account_number, '')::varchar AS counterparty_account_number,
+  ''::varchar AS description,
+  ''::varchar AS category
+FROM entries
+JOIN accounts ON accounts.id = entries.account_id
+LEFT JOIN transfers ON transfers.id = entries.transfer_id
+LEFT JOIN accounts AS payer ON payer.id = transfers.from_account_id
+WHERE entries.account_id = sqlc.arg(account_id)
+  AND entries.created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+  AND ((entries.transfer_id IS NULL AND entries.created_at = accounts.created_at)
+    OR (transfers.from_account_id <> sqlc.arg(account_id) AND transfers.to_account_id <> sqlc.arg(account_id)))
+ORDER BY created_at, transfer_id, entry_id;
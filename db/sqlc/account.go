@@ -0,0 +1,21 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/TriNgoc2077/Simple-Bank/util"
+)
+
+//MarshalJSON adds formatted_balance, the balance in the currency's decimals grouped for display ("1,234.56"),
+//next to the raw integer balance, which stays the precise value clients should compute with
+func (account Account) MarshalJSON() ([]byte, error) {
+	//plainAccount has the fields but not the methods of Account, so Marshal doesn't recurse into this one
+	type plainAccount Account
+	return json.Marshal(struct {
+		plainAccount
+		FormattedBalance string `json:"formatted_balance"`
+	}{
+		plainAccount: plainAccount(account),
+		FormattedBalance: util.FormatAmountGrouped(account.Balance, account.Currency),
+	})
+}
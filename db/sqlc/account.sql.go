@@ -7,13 +7,16 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const addAccountBalance = `-- name: AddAccountBalance :one
 UPDATE accounts
-SET balance = balance + $1
+SET balance = balance + $1, updated_at = now()
 WHERE id = $2
-RETURNING id, owner, balance, currency, created_at
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
 `
 
 type AddAccountBalanceParams struct {
@@ -22,7 +25,7 @@ type AddAccountBalanceParams struct {
 }
 
 func (q *Queries) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
-	row := q.db.QueryRowContext(ctx, addAccountBalance, arg.Amount, arg.ID)
+	row := q.db.QueryRow(ctx, addAccountBalance, arg.Amount, arg.ID)
 	var i Account
 	err := row.Scan(
 		&i.ID,
@@ -30,27 +33,86 @@ func (q *Queries) AddAccountBalance(ctx context.Context, arg AddAccountBalancePa
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
 	)
 	return i, err
 }
 
+const addAccountHeldBalance = `-- name: AddAccountHeldBalance :one
+UPDATE accounts
+SET held_balance = held_balance + $1, updated_at = now()
+WHERE id = $2
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
+`
+
+type AddAccountHeldBalanceParams struct {
+	Amount int64 `json:"amount"`
+	ID     int64 `json:"id"`
+}
+
+func (q *Queries) AddAccountHeldBalance(ctx context.Context, arg AddAccountHeldBalanceParams) (Account, error) {
+	row := q.db.QueryRow(ctx, addAccountHeldBalance, arg.Amount, arg.ID)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const countAccounts = `-- name: CountAccounts :one
+SELECT COUNT(*) FROM accounts
+WHERE ($1::varchar IS NULL OR owner = $1)
+  AND ($2::varchar IS NULL OR currency = $2)
+`
+
+type CountAccountsParams struct {
+	Owner    pgtype.Text `json:"owner"`
+	Currency pgtype.Text `json:"currency"`
+}
+
+func (q *Queries) CountAccounts(ctx context.Context, arg CountAccountsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countAccounts, arg.Owner, arg.Currency)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAccount = `-- name: CreateAccount :one
 INSERT INTO accounts (
-  owner, balance, currency
+  owner, balance, currency, name
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4
 )
-RETURNING id, owner, balance, currency, created_at
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
 `
 
 type CreateAccountParams struct {
-	Owner    string `json:"owner"`
-	Balance  int64  `json:"balance"`
-	Currency string `json:"currency"`
+	Owner    string      `json:"owner"`
+	Balance  int64       `json:"balance"`
+	Currency string      `json:"currency"`
+	Name     pgtype.Text `json:"name"`
 }
 
 func (q *Queries) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
-	row := q.db.QueryRowContext(ctx, createAccount, arg.Owner, arg.Balance, arg.Currency)
+	row := q.db.QueryRow(ctx, createAccount,
+		arg.Owner,
+		arg.Balance,
+		arg.Currency,
+		arg.Name,
+	)
 	var i Account
 	err := row.Scan(
 		&i.ID,
@@ -58,6 +120,11 @@ func (q *Queries) CreateAccount(ctx context.Context, arg CreateAccountParams) (A
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
 	)
 	return i, err
 }
@@ -68,17 +135,40 @@ WHERE id = $1
 `
 
 func (q *Queries) DeleteAccount(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteAccount, id)
+	_, err := q.db.Exec(ctx, deleteAccount, id)
 	return err
 }
 
 const getAccount = `-- name: GetAccount :one
-SELECT id, owner, balance, currency, created_at FROM accounts
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetAccount(ctx context.Context, id int64) (Account, error) {
-	row := q.db.QueryRowContext(ctx, getAccount, id)
+	row := q.db.QueryRow(ctx, getAccount, id)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const getAccountByNumber = `-- name: GetAccountByNumber :one
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
+WHERE account_number = $1 LIMIT 1
+`
+
+func (q *Queries) GetAccountByNumber(ctx context.Context, accountNumber string) (Account, error) {
+	row := q.db.QueryRow(ctx, getAccountByNumber, accountNumber)
 	var i Account
 	err := row.Scan(
 		&i.ID,
@@ -86,18 +176,79 @@ func (q *Queries) GetAccount(ctx context.Context, id int64) (Account, error) {
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const getAccountByOwnerCurrency = `-- name: GetAccountByOwnerCurrency :one
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
+WHERE owner = $1 AND currency = $2 LIMIT 1
+`
+
+type GetAccountByOwnerCurrencyParams struct {
+	Owner    string `json:"owner"`
+	Currency string `json:"currency"`
+}
+
+func (q *Queries) GetAccountByOwnerCurrency(ctx context.Context, arg GetAccountByOwnerCurrencyParams) (Account, error) {
+	row := q.db.QueryRow(ctx, getAccountByOwnerCurrency, arg.Owner, arg.Currency)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const getAccountByOwnerName = `-- name: GetAccountByOwnerName :one
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
+WHERE owner = $1 AND name = $2 LIMIT 1
+`
+
+type GetAccountByOwnerNameParams struct {
+	Owner string      `json:"owner"`
+	Name  pgtype.Text `json:"name"`
+}
+
+func (q *Queries) GetAccountByOwnerName(ctx context.Context, arg GetAccountByOwnerNameParams) (Account, error) {
+	row := q.db.QueryRow(ctx, getAccountByOwnerName, arg.Owner, arg.Name)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
 	)
 	return i, err
 }
 
 const getAccountForUpdate = `-- name: GetAccountForUpdate :one
-SELECT id, owner, balance, currency, created_at FROM accounts
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
 WHERE id = $1 LIMIT 1
 FOR NO KEY UPDATE
 `
 
 func (q *Queries) GetAccountForUpdate(ctx context.Context, id int64) (Account, error) {
-	row := q.db.QueryRowContext(ctx, getAccountForUpdate, id)
+	row := q.db.QueryRow(ctx, getAccountForUpdate, id)
 	var i Account
 	err := row.Scan(
 		&i.ID,
@@ -105,24 +256,92 @@ func (q *Queries) GetAccountForUpdate(ctx context.Context, id int64) (Account, e
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
 	)
 	return i, err
 }
 
+const getAccountMetadata = `-- name: GetAccountMetadata :one
+SELECT metadata FROM accounts
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetAccountMetadata(ctx context.Context, id int64) (json.RawMessage, error) {
+	row := q.db.QueryRow(ctx, getAccountMetadata, id)
+	var metadata json.RawMessage
+	err := row.Scan(&metadata)
+	return metadata, err
+}
+
+const listAccountBalanceDrift = `-- name: ListAccountBalanceDrift :many
+SELECT
+  accounts.id,
+  accounts.balance,
+  COALESCE(SUM(entries.amount), 0)::bigint AS entries_total
+FROM accounts
+LEFT JOIN entries ON entries.account_id = accounts.id
+GROUP BY accounts.id
+HAVING accounts.balance <> COALESCE(SUM(entries.amount), 0)
+ORDER BY accounts.id
+`
+
+type ListAccountBalanceDriftRow struct {
+	ID           int64 `json:"id"`
+	Balance      int64 `json:"balance"`
+	EntriesTotal int64 `json:"entries_total"`
+}
+
+func (q *Queries) ListAccountBalanceDrift(ctx context.Context) ([]ListAccountBalanceDriftRow, error) {
+	rows, err := q.db.Query(ctx, listAccountBalanceDrift)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAccountBalanceDriftRow{}
+	for rows.Next() {
+		var i ListAccountBalanceDriftRow
+		if err := rows.Scan(&i.ID, &i.Balance, &i.EntriesTotal); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listAccounts = `-- name: ListAccounts :many
-SELECT id, owner, balance, currency, created_at FROM accounts
-ORDER BY id
-LIMIT $1
-OFFSET $2
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
+WHERE ($1::varchar IS NULL OR owner = $1)
+  AND ($2::varchar IS NULL OR currency = $2)
+ORDER BY
+  CASE WHEN $3::text = 'created_at' THEN created_at END,
+  id
+LIMIT $5
+OFFSET $4
 `
 
 type ListAccountsParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	Owner    pgtype.Text `json:"owner"`
+	Currency pgtype.Text `json:"currency"`
+	SortBy   string      `json:"sort_by"`
+	Offset   int32       `json:"offset"`
+	Limit    int32       `json:"limit"`
 }
 
 func (q *Queries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
-	rows, err := q.db.QueryContext(ctx, listAccounts, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listAccounts,
+		arg.Owner,
+		arg.Currency,
+		arg.SortBy,
+		arg.Offset,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -136,25 +355,100 @@ func (q *Queries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]A
 			&i.Balance,
 			&i.Currency,
 			&i.CreatedAt,
+			&i.HeldBalance,
+			&i.Name,
+			&i.UpdatedAt,
+			&i.AccountNumber,
+			&i.Metadata,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountsByIDs = `-- name: ListAccountsByIDs :many
+SELECT id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata FROM accounts
+WHERE id = ANY($1::bigint[])
+  AND ($2::varchar IS NULL OR owner = $2)
+ORDER BY id
+`
+
+type ListAccountsByIDsParams struct {
+	Ids   []int64     `json:"ids"`
+	Owner pgtype.Text `json:"owner"`
+}
+
+func (q *Queries) ListAccountsByIDs(ctx context.Context, arg ListAccountsByIDsParams) ([]Account, error) {
+	rows, err := q.db.Query(ctx, listAccountsByIDs, arg.Ids, arg.Owner)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	items := []Account{}
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.HeldBalance,
+			&i.Name,
+			&i.UpdatedAt,
+			&i.AccountNumber,
+			&i.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return items, nil
 }
 
+const setAccountMetadata = `-- name: SetAccountMetadata :one
+UPDATE accounts
+SET metadata = $1, updated_at = now()
+WHERE id = $2
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
+`
+
+type SetAccountMetadataParams struct {
+	Metadata json.RawMessage `json:"metadata"`
+	ID       int64           `json:"id"`
+}
+
+func (q *Queries) SetAccountMetadata(ctx context.Context, arg SetAccountMetadataParams) (Account, error) {
+	row := q.db.QueryRow(ctx, setAccountMetadata, arg.Metadata, arg.ID)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
 const updateAccount = `-- name: UpdateAccount :one
 UPDATE accounts
-SET balance = $2
+SET balance = $2, updated_at = now()
 WHERE id = $1
-RETURNING id, owner, balance, currency, created_at
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
 `
 
 type UpdateAccountParams struct {
@@ -163,7 +457,72 @@ type UpdateAccountParams struct {
 }
 
 func (q *Queries) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
-	row := q.db.QueryRowContext(ctx, updateAccount, arg.ID, arg.Balance)
+	row := q.db.QueryRow(ctx, updateAccount, arg.ID, arg.Balance)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const updateAccountCurrency = `-- name: UpdateAccountCurrency :one
+UPDATE accounts
+SET currency = $1, updated_at = now()
+WHERE accounts.id = $2
+  AND accounts.balance = 0
+  AND NOT EXISTS (
+    SELECT 1 FROM transfers
+    WHERE transfers.from_account_id = accounts.id OR transfers.to_account_id = accounts.id
+  )
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
+`
+
+type UpdateAccountCurrencyParams struct {
+	Currency string `json:"currency"`
+	ID       int64  `json:"id"`
+}
+
+func (q *Queries) UpdateAccountCurrency(ctx context.Context, arg UpdateAccountCurrencyParams) (Account, error) {
+	row := q.db.QueryRow(ctx, updateAccountCurrency, arg.Currency, arg.ID)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
+	)
+	return i, err
+}
+
+const updateAccountName = `-- name: UpdateAccountName :one
+UPDATE accounts
+SET name = $1, updated_at = now()
+WHERE id = $2
+RETURNING id, owner, balance, currency, created_at, held_balance, name, updated_at, account_number, metadata
+`
+
+type UpdateAccountNameParams struct {
+	Name pgtype.Text `json:"name"`
+	ID   int64       `json:"id"`
+}
+
+func (q *Queries) UpdateAccountName(ctx context.Context, arg UpdateAccountNameParams) (Account, error) {
+	row := q.db.QueryRow(ctx, updateAccountName, arg.Name, arg.ID)
 	var i Account
 	err := row.Scan(
 		&i.ID,
@@ -171,6 +530,11 @@ func (q *Queries) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (A
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.HeldBalance,
+		&i.Name,
+		&i.UpdatedAt,
+		&i.AccountNumber,
+		&i.Metadata,
 	)
 	return i, err
 }
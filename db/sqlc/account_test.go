@@ -2,11 +2,12 @@ package db
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 )
 func createRandomAccount(t *testing.T) Account {
@@ -28,6 +29,20 @@ func createRandomAccount(t *testing.T) Account {
 func TestCreateAccount(t *testing.T) {
 	createRandomAccount(t)
 }
+
+func TestCreateAccountDuplicateCurrency(t *testing.T) {
+	account1 := createRandomAccount(t)
+
+	//an owner can only hold one account per currency
+	_, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    account1.Owner,
+		Balance:  util.RandomMoney(),
+		Currency: account1.Currency,
+	})
+	require.Error(t, err)
+	require.True(t, IsUniqueViolation(err))
+}
+
 func TestGetAccount(t *testing.T) {
 	account1 := createRandomAccount(t)
 	account2, err := testQueries.GetAccount(context.Background(), account1.ID)
@@ -39,6 +54,33 @@ func TestGetAccount(t *testing.T) {
 	require.Equal(t, account1.Balance, account2.Balance)
 	require.Equal(t, account1.Currency, account2.Currency)
 	require.WithinDuration(t, account1.CreatedAt, account2.CreatedAt, time.Second)
+	require.Equal(t, account1.UpdatedAt, account2.UpdatedAt)
+}
+
+func TestGetAccountByNumber(t *testing.T) {
+	account1 := createRandomAccount(t)
+	require.Len(t, account1.AccountNumber, util.AccountNumberLength)
+	require.True(t, util.IsAccountNumber(account1.AccountNumber))
+
+	account2, err := testQueries.GetAccountByNumber(context.Background(), account1.AccountNumber)
+	require.NoError(t, err)
+	require.Equal(t, account1, account2)
+
+	_, err = testQueries.GetAccountByNumber(context.Background(), "not-a-number")
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestAddAccountBalanceUpdatedAt(t *testing.T) {
+	account1 := createRandomAccount(t)
+	require.Equal(t, account1.CreatedAt, account1.UpdatedAt)
+
+	account2, err := testQueries.AddAccountBalance(context.Background(), AddAccountBalanceParams{
+		ID: account1.ID,
+		Amount: 10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.CreatedAt, account2.CreatedAt)
+	require.True(t, account2.UpdatedAt.After(account1.UpdatedAt))
 }
 
 func TestUpdateAccount(t *testing.T) {
@@ -59,6 +101,43 @@ func TestUpdateAccount(t *testing.T) {
 	require.WithinDuration(t, account1.CreatedAt, account2.CreatedAt, time.Second)
 }
 
+func TestUpdateAccountCurrency(t *testing.T) {
+	account1, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Balance:  0,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+
+	account2, err := testQueries.UpdateAccountCurrency(context.Background(), UpdateAccountCurrencyParams{
+		ID: account1.ID,
+		Currency: "EUR",
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, account2.ID)
+	require.Equal(t, "EUR", account2.Currency)
+
+	//an account that has held money keeps its currency
+	account3 := createRandomAccount(t)
+	_, err = testQueries.UpdateAccount(context.Background(), UpdateAccountParams{ID: account3.ID, Balance: 10})
+	require.NoError(t, err)
+	_, err = testQueries.UpdateAccountCurrency(context.Background(), UpdateAccountCurrencyParams{
+		ID: account3.ID,
+		Currency: "EUR",
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	//so does an empty account with transfer history
+	transfer := createRandomTransfer(t)
+	_, err = testQueries.UpdateAccount(context.Background(), UpdateAccountParams{ID: transfer.FromAccountID, Balance: 0})
+	require.NoError(t, err)
+	_, err = testQueries.UpdateAccountCurrency(context.Background(), UpdateAccountCurrencyParams{
+		ID: transfer.FromAccountID,
+		Currency: "EUR",
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
 func TestDeleteAccount(t *testing.T) {
 	account1 := createRandomAccount(t);
 	err := testQueries.DeleteAccount(context.Background(), account1.ID)
@@ -66,7 +145,7 @@ func TestDeleteAccount(t *testing.T) {
 
 	account2, err := testQueries.GetAccount(context.Background(), account1.ID)
 	require.Error(t, err)
-	require.EqualError(t, err, sql.ErrNoRows.Error())
+	require.EqualError(t, err, ErrRecordNotFound.Error())
 	require.Empty(t, account2)
 }
 
@@ -87,4 +166,247 @@ func TestListAccounts(t *testing.T) {
 	for _, account := range accounts {
 		require.NotEmpty(t, account)
 	}
-}
\ No newline at end of file
+}
+
+// concurrent deposits to the same account must not lose updates:
+// AddAccountBalance does balance = balance + amount in a single UPDATE, so postgres serializes the writes on the row lock
+func TestAddAccountBalanceConcurrent(t *testing.T) {
+	account := createRandomAccount(t)
+
+	n := 10
+	amount := int64(10)
+	errs := make(chan error)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := testQueries.AddAccountBalance(context.Background(), AddAccountBalanceParams{
+				ID: account.ID,
+				Amount: amount,
+			})
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		err := <-errs
+		require.NoError(t, err)
+	}
+
+	updatedAccount, err := testQueries.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance+int64(n)*amount, updatedAccount.Balance)
+}
+
+
+func TestCountAccounts(t *testing.T) {
+	before, err := testQueries.CountAccounts(context.Background(), CountAccountsParams{})
+	require.NoError(t, err)
+
+	createRandomAccount(t)
+
+	after, err := testQueries.CountAccounts(context.Background(), CountAccountsParams{})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, after, before+1)
+}
+
+func TestListAccountsSortByCreatedAt(t *testing.T) {
+	for i:=0; i<5; i++ {
+		createRandomAccount(t)
+	}
+
+	arg := ListAccountsParams{
+		SortBy: "created_at",
+		Limit: 5,
+		Offset: 0,
+	}
+
+	accounts, err := testQueries.ListAccounts(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, accounts, 5)
+
+	for i := 1; i < len(accounts); i++ {
+		require.False(t, accounts[i].CreatedAt.Before(accounts[i-1].CreatedAt))
+	}
+}
+func TestListAccountsFilter(t *testing.T) {
+	owner := util.RandomOwner()
+	for _, currency := range []string{"USD", "EUR"} {
+		_, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+			Owner: owner,
+			Currency: currency,
+		})
+		require.NoError(t, err)
+	}
+
+	accounts, err := testQueries.ListAccounts(context.Background(), ListAccountsParams{
+		Owner: pgtype.Text{String: owner, Valid: true},
+		Limit: 5,
+	})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+
+	arg := ListAccountsParams{
+		Owner: pgtype.Text{String: owner, Valid: true},
+		Currency: pgtype.Text{String: "USD", Valid: true},
+		Limit: 5,
+	}
+	accounts, err = testQueries.ListAccounts(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, owner, accounts[0].Owner)
+	require.Equal(t, "USD", accounts[0].Currency)
+
+	total, err := testQueries.CountAccounts(context.Background(), CountAccountsParams{
+		Owner: arg.Owner,
+		Currency: arg.Currency,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+}
+
+func TestListAccountBalanceDrift(t *testing.T) {
+	result, err := NewStore(testDB, nil).CreateAccountTx(context.Background(), CreateAccountTxParams{
+		Owner: util.RandomOwner(),
+		Currency: util.RandomCurrency(),
+		InitialBalance: 100,
+	})
+	require.NoError(t, err)
+	account := result.Account
+
+	drift, err := testQueries.ListAccountBalanceDrift(context.Background())
+	require.NoError(t, err)
+	for _, row := range drift {
+		require.NotEqual(t, account.ID, row.ID)
+	}
+
+	//corrupt the balance behind the entries' back
+	_, err = testQueries.UpdateAccount(context.Background(), UpdateAccountParams{ID: account.ID, Balance: 150})
+	require.NoError(t, err)
+
+	drift, err = testQueries.ListAccountBalanceDrift(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, drift, ListAccountBalanceDriftRow{ID: account.ID, Balance: 150, EntriesTotal: 100})
+}
+
+func TestAccountName(t *testing.T) {
+	owner := util.RandomOwner()
+	name := pgtype.Text{String: "savings", Valid: true}
+
+	account, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner: owner,
+		Currency: "USD",
+		Name: name,
+	})
+	require.NoError(t, err)
+	require.Equal(t, name, account.Name)
+
+	found, err := testQueries.GetAccountByOwnerName(context.Background(), GetAccountByOwnerNameParams{Owner: owner, Name: name})
+	require.NoError(t, err)
+	require.Equal(t, account.ID, found.ID)
+
+	//names are unique per owner only
+	_, err = testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner: owner,
+		Currency: "EUR",
+		Name: name,
+	})
+	require.True(t, IsConstraintViolation(err, OwnerNameKey))
+
+	_, err = testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner: util.RandomOwner(),
+		Currency: "EUR",
+		Name: name,
+	})
+	require.NoError(t, err)
+
+	updated, err := testQueries.UpdateAccountName(context.Background(), UpdateAccountNameParams{ID: account.ID})
+	require.NoError(t, err)
+	require.False(t, updated.Name.Valid)
+
+	_, err = testQueries.GetAccountByOwnerName(context.Background(), GetAccountByOwnerNameParams{Owner: owner, Name: name})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestGetAccountByOwnerCurrency(t *testing.T) {
+	account1 := createRandomAccount(t)
+
+	account2, err := testQueries.GetAccountByOwnerCurrency(context.Background(), GetAccountByOwnerCurrencyParams{
+		Owner: account1.Owner,
+		Currency: account1.Currency,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, account2.ID)
+
+	_, err = testQueries.GetAccountByOwnerCurrency(context.Background(), GetAccountByOwnerCurrencyParams{
+		Owner: account1.Owner,
+		Currency: "JPY",
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestListAccountsByIDs(t *testing.T) {
+	owner := util.RandomOwner()
+	account1, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{Owner: owner, Currency: util.USD})
+	require.NoError(t, err)
+	account2, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{Owner: owner, Currency: util.EUR})
+	require.NoError(t, err)
+	stranger := createRandomAccount(t)
+
+	ids := []int64{account2.ID, stranger.ID, account1.ID, account2.ID + 1000}
+
+	//the unknown id is dropped
+	accounts, err := testQueries.ListAccountsByIDs(context.Background(), ListAccountsByIDsParams{Ids: ids})
+	require.NoError(t, err)
+	require.Equal(t, []Account{account1, account2, stranger}, accounts)
+
+	//so is the stranger's account once filtered by owner
+	accounts, err = testQueries.ListAccountsByIDs(context.Background(), ListAccountsByIDsParams{
+		Ids: ids,
+		Owner: pgtype.Text{String: owner, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Account{account1, account2}, accounts)
+}
+
+func TestAccountMetadata(t *testing.T) {
+	account1 := createRandomAccount(t)
+	require.JSONEq(t, `{}`, string(account1.Metadata))
+
+	account2, err := testQueries.SetAccountMetadata(context.Background(), SetAccountMetadataParams{
+		ID: account1.ID,
+		Metadata: json.RawMessage(`{"crm_id": "C-42", "labels": ["vip"]}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"crm_id": "C-42", "labels": ["vip"]}`, string(account2.Metadata))
+	require.True(t, account2.UpdatedAt.After(account1.UpdatedAt))
+
+	metadata, err := testQueries.GetAccountMetadata(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.JSONEq(t, string(account2.Metadata), string(metadata))
+
+	//the check constraint keeps it an object
+	_, err = testQueries.SetAccountMetadata(context.Background(), SetAccountMetadataParams{
+		ID: account1.ID,
+		Metadata: json.RawMessage(`["vip"]`),
+	})
+	require.True(t, IsConstraintViolation(err, "account_metadata_object"))
+
+	_, err = testQueries.GetAccountMetadata(context.Background(), account1.ID+1_000_000)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestAccountMarshalJSON(t *testing.T) {
+	account := Account{ID: 1, Owner: "tom", Balance: 123456, Currency: util.USD, Metadata: json.RawMessage(`{}`)}
+	body, err := json.Marshal(account)
+	require.NoError(t, err)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(body, &got))
+	require.Equal(t, float64(123456), got["balance"])
+	require.Equal(t, "1,234.56", got["formatted_balance"])
+
+	//the extra field is ignored when decoding back
+	var decoded Account
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	require.Equal(t, account, decoded)
+}
@@ -0,0 +1,64 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: balance_snapshot.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createBalanceSnapshots = `-- name: CreateBalanceSnapshots :execrows
+INSERT INTO balance_snapshots (account_id, snapshot_date, balance)
+SELECT
+  accounts.id,
+  $1::date,
+  accounts.balance - COALESCE((
+    SELECT SUM(entries.amount) FROM entries
+    WHERE entries.account_id = accounts.id
+      AND entries.created_at >= $1::date + 1
+  ), 0)::bigint
+FROM accounts
+WHERE accounts.created_at < $1::date + 1
+ON CONFLICT (account_id, snapshot_date) DO NOTHING
+`
+
+// the job may run well after midnight, so the balance is rolled back by the entries made since the day ended
+// one statement reads one snapshot, balances and entries always agree
+// taking the same day again changes nothing
+func (q *Queries) CreateBalanceSnapshots(ctx context.Context, snapshotDate pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, createBalanceSnapshots, snapshotDate)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getBalanceSnapshotAsOf = `-- name: GetBalanceSnapshotAsOf :one
+SELECT account_id, snapshot_date, balance, created_at FROM balance_snapshots
+WHERE account_id = $1
+  AND snapshot_date <= $2::date
+ORDER BY snapshot_date DESC
+LIMIT 1
+`
+
+type GetBalanceSnapshotAsOfParams struct {
+	AccountID int64       `json:"account_id"`
+	AsOf      pgtype.Date `json:"as_of"`
+}
+
+// the latest snapshot on or before as_of, its snapshot_date says which day it is for
+func (q *Queries) GetBalanceSnapshotAsOf(ctx context.Context, arg GetBalanceSnapshotAsOfParams) (BalanceSnapshot, error) {
+	row := q.db.QueryRow(ctx, getBalanceSnapshotAsOf, arg.AccountID, arg.AsOf)
+	var i BalanceSnapshot
+	err := row.Scan(
+		&i.AccountID,
+		&i.SnapshotDate,
+		&i.Balance,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateBalanceSnapshots(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(testDB, nil)
+	account1 := createFundedAccount(t, 100)
+	account2 := createFundedAccount(t, 0)
+
+	//the accounts are from two days ago, so yesterday's snapshot includes them
+	_, err := testDB.Exec(ctx, "UPDATE accounts SET created_at = created_at - interval '2 days' WHERE id = ANY($1)", []int64{account1.ID, account2.ID})
+	require.NoError(t, err)
+	//made today, so yesterday's snapshot rolls it back
+	_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30})
+	require.NoError(t, err)
+
+	yesterday := SnapshotDate(time.Now())
+	created, err := testQueries.CreateBalanceSnapshots(ctx, yesterday)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, created, int64(2))
+
+	snapshot, err := testQueries.GetBalanceSnapshotAsOf(ctx, GetBalanceSnapshotAsOfParams{AccountID: account1.ID, AsOf: yesterday})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), snapshot.Balance)
+	require.Equal(t, yesterday.Time, snapshot.SnapshotDate.Time.UTC())
+
+	//the day is already taken
+	created, err = testQueries.CreateBalanceSnapshots(ctx, yesterday)
+	require.NoError(t, err)
+	require.Zero(t, created)
+
+	today := SnapshotDate(time.Now().AddDate(0, 0, 1))
+	_, err = testQueries.CreateBalanceSnapshots(ctx, today)
+	require.NoError(t, err)
+	snapshot, err = testQueries.GetBalanceSnapshotAsOf(ctx, GetBalanceSnapshotAsOfParams{
+		AccountID: account2.ID,
+		AsOf: pgtype.Date{Time: today.Time.AddDate(0, 0, 7), Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(30), snapshot.Balance)
+
+	_, err = testQueries.GetBalanceSnapshotAsOf(ctx, GetBalanceSnapshotAsOfParams{
+		AccountID: account1.ID,
+		AsOf: pgtype.Date{Time: yesterday.Time.AddDate(0, 0, -1), Valid: true},
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestSnapshotDate(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 30, 0, 0, time.UTC)
+	require.Equal(t, pgtype.Date{Time: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC), Valid: true}, SnapshotDate(now))
+	require.Equal(t, time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC), NextSnapshot(now))
+
+	//the day boundary is UTC whatever the location of now
+	local := time.Date(2024, time.March, 1, 22, 0, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	require.Equal(t, time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC), SnapshotDate(local).Time)
+}
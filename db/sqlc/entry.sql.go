@@ -7,30 +7,63 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countEntriesByAccount = `-- name: CountEntriesByAccount :one
+SELECT COUNT(*) FROM entries
+WHERE account_id = $1
+  AND ($2::timestamp IS NULL OR created_at >= $2)
+  AND ($3::timestamp IS NULL OR created_at <= $3)
+  AND ($4::text IS NULL
+    OR ($4 = 'positive' AND amount > 0)
+    OR ($4 = 'negative' AND amount < 0))
+`
+
+type CountEntriesByAccountParams struct {
+	AccountID int64            `json:"account_id"`
+	FromTime  pgtype.Timestamp `json:"from_time"`
+	ToTime    pgtype.Timestamp `json:"to_time"`
+	Sign      pgtype.Text      `json:"sign"`
+}
+
+func (q *Queries) CountEntriesByAccount(ctx context.Context, arg CountEntriesByAccountParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countEntriesByAccount,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Sign,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createEntry = `-- name: CreateEntry :one
 INSERT INTO entries (
-  account_id, amount
+  account_id, amount, transfer_id
 ) VALUES (
-    $1, $2
+    $1, $2, $3
 )
-RETURNING id, account_id, amount, created_at
+RETURNING id, account_id, amount, created_at, transfer_id
 `
 
 type CreateEntryParams struct {
-	AccountID int64 `json:"account_id"`
-	Amount    int64 `json:"amount"`
+	AccountID  int64       `json:"account_id"`
+	Amount     int64       `json:"amount"`
+	TransferID pgtype.Int8 `json:"transfer_id"`
 }
 
 func (q *Queries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, createEntry, arg.AccountID, arg.Amount)
+	row := q.db.QueryRow(ctx, createEntry, arg.AccountID, arg.Amount, arg.TransferID)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
 	)
 	return i, err
 }
@@ -41,29 +74,113 @@ WHERE id = $1
 `
 
 func (q *Queries) DeleteEntry(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteEntry, id)
+	_, err := q.db.Exec(ctx, deleteEntry, id)
 	return err
 }
 
 const getEntry = `-- name: GetEntry :one
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id FROM entries
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetEntry(ctx context.Context, id int64) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, getEntry, id)
+	row := q.db.QueryRow(ctx, getEntry, id)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
 	)
 	return i, err
 }
 
+const getEntryTotals = `-- name: GetEntryTotals :one
+SELECT
+  COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0)::bigint AS total_deposited,
+  COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0)::bigint AS total_withdrawn
+FROM entries
+WHERE account_id = $1
+  AND ($2::timestamp IS NULL OR created_at >= $2)
+  AND ($3::timestamp IS NULL OR created_at <= $3)
+`
+
+type GetEntryTotalsParams struct {
+	AccountID int64            `json:"account_id"`
+	FromTime  pgtype.Timestamp `json:"from_time"`
+	ToTime    pgtype.Timestamp `json:"to_time"`
+}
+
+type GetEntryTotalsRow struct {
+	TotalDeposited int64 `json:"total_deposited"`
+	TotalWithdrawn int64 `json:"total_withdrawn"`
+}
+
+func (q *Queries) GetEntryTotals(ctx context.Context, arg GetEntryTotalsParams) (GetEntryTotalsRow, error) {
+	row := q.db.QueryRow(ctx, getEntryTotals, arg.AccountID, arg.FromTime, arg.ToTime)
+	var i GetEntryTotalsRow
+	err := row.Scan(&i.TotalDeposited, &i.TotalWithdrawn)
+	return i, err
+}
+
+const listEntriesByAccount = `-- name: ListEntriesByAccount :many
+SELECT id, account_id, amount, created_at, transfer_id FROM entries
+WHERE account_id = $1
+  AND ($2::timestamp IS NULL OR created_at >= $2)
+  AND ($3::timestamp IS NULL OR created_at <= $3)
+  AND ($4::text IS NULL
+    OR ($4 = 'positive' AND amount > 0)
+    OR ($4 = 'negative' AND amount < 0))
+ORDER BY id
+LIMIT $6
+OFFSET $5
+`
+
+type ListEntriesByAccountParams struct {
+	AccountID int64            `json:"account_id"`
+	FromTime  pgtype.Timestamp `json:"from_time"`
+	ToTime    pgtype.Timestamp `json:"to_time"`
+	Sign      pgtype.Text      `json:"sign"`
+	Offset    int32            `json:"offset"`
+	Limit     int32            `json:"limit"`
+}
+
+func (q *Queries) ListEntriesByAccount(ctx context.Context, arg ListEntriesByAccountParams) ([]Entry, error) {
+	rows, err := q.db.Query(ctx, listEntriesByAccount,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Sign,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.TransferID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listEntry = `-- name: ListEntry :many
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id FROM entries
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -75,7 +192,7 @@ type ListEntryParams struct {
 }
 
 func (q *Queries) ListEntry(ctx context.Context, arg ListEntryParams) ([]Entry, error) {
-	rows, err := q.db.QueryContext(ctx, listEntry, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listEntry, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -88,14 +205,12 @@ func (q *Queries) ListEntry(ctx context.Context, arg ListEntryParams) ([]Entry,
 			&i.AccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.TransferID,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
@@ -106,7 +221,7 @@ const updateEntry = `-- name: UpdateEntry :one
 UPDATE entries
   set amount = $2
 WHERE id = $1
-RETURNING id, account_id, amount, created_at
+RETURNING id, account_id, amount, created_at, transfer_id
 `
 
 type UpdateEntryParams struct {
@@ -115,13 +230,14 @@ type UpdateEntryParams struct {
 }
 
 func (q *Queries) UpdateEntry(ctx context.Context, arg UpdateEntryParams) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, updateEntry, arg.ID, arg.Amount)
+	row := q.db.QueryRow(ctx, updateEntry, arg.ID, arg.Amount)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
 	)
 	return i, err
 }
@@ -2,12 +2,12 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,7 +72,7 @@ func TestDeleteEntry(t *testing.T) {
 
 	entry2, err := testQueries.GetEntry(context.Background(), entry1.ID)
 	require.Error(t, err)
-	require.EqualError(t, err, sql.ErrNoRows.Error())
+	require.EqualError(t, err, ErrRecordNotFound.Error())
 	require.Empty(t, entry2)
 }
 
@@ -93,4 +93,96 @@ func TestListEntry(t *testing.T) {
 	for _, entry := range entries {
 		require.NotEmpty(t, entry)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetEntryTotals(t *testing.T) {
+	account := createRandomAccount(t)
+
+	for _, amount := range []int64{50, -20, 30, -5} {
+		_, err := testQueries.CreateEntry(context.Background(), CreateEntryParams{
+			AccountID: account.ID,
+			Amount: amount,
+		})
+		require.NoError(t, err)
+	}
+
+	totals, err := testQueries.GetEntryTotals(context.Background(), GetEntryTotalsParams{AccountID: account.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(80), totals.TotalDeposited)
+	require.Equal(t, int64(25), totals.TotalWithdrawn)
+
+	//a range in the past matches nothing
+	totals, err = testQueries.GetEntryTotals(context.Background(), GetEntryTotalsParams{
+		AccountID: account.ID,
+		ToTime: pgtype.Timestamp{Time: time.Now().UTC().Add(-24 * time.Hour), Valid: true},
+	})
+	require.NoError(t, err)
+	require.Zero(t, totals.TotalDeposited)
+	require.Zero(t, totals.TotalWithdrawn)
+}
+
+func TestListEntriesByAccount(t *testing.T) {
+	account := createRandomAccount(t)
+	for i := 0; i < 6; i++ {
+		_, err := testQueries.CreateEntry(context.Background(), CreateEntryParams{
+			AccountID: account.ID,
+			Amount: util.RandomInt(-100, 100),
+		})
+		require.NoError(t, err)
+	}
+
+	entries, err := testQueries.ListEntriesByAccount(context.Background(), ListEntriesByAccountParams{
+		AccountID: account.ID,
+		Limit: 4,
+		Offset: 0,
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	for _, entry := range entries {
+		require.Equal(t, account.ID, entry.AccountID)
+	}
+
+	total, err := testQueries.CountEntriesByAccount(context.Background(), CountEntriesByAccountParams{AccountID: account.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), total)
+
+	//nothing was created before yesterday
+	total, err = testQueries.CountEntriesByAccount(context.Background(), CountEntriesByAccountParams{
+		AccountID: account.ID,
+		ToTime: pgtype.Timestamp{Time: time.Now().UTC().Add(-24 * time.Hour), Valid: true},
+	})
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
+
+func TestListEntriesByAccountSign(t *testing.T) {
+	account := createRandomAccount(t)
+	for _, amount := range []int64{10, -5, 20, -7, 30} {
+		_, err := testQueries.CreateEntry(context.Background(), CreateEntryParams{
+			AccountID: account.ID,
+			Amount: amount,
+		})
+		require.NoError(t, err)
+	}
+
+	for sign, want := range map[string]int{"positive": 3, "negative": 2} {
+		arg := ListEntriesByAccountParams{
+			AccountID: account.ID,
+			Sign: pgtype.Text{String: sign, Valid: true},
+			Limit: 10,
+		}
+		entries, err := testQueries.ListEntriesByAccount(context.Background(), arg)
+		require.NoError(t, err)
+		require.Len(t, entries, want)
+		for _, entry := range entries {
+			require.Equal(t, sign == "positive", entry.Amount > 0)
+		}
+
+		total, err := testQueries.CountEntriesByAccount(context.Background(), CountEntriesByAccountParams{
+			AccountID: account.ID,
+			Sign: arg.Sign,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(want), total)
+	}
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//ErrRecordNotFound is returned by :one queries that match no row
+var ErrRecordNotFound = pgx.ErrNoRows
+
+//ErrInsufficientBalance is returned by TransferTx when the sender can't cover the amount and fee
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+//ErrAmountBelowMinimum is returned by TransferTx when the amount is below arg.MinimumAmount
+var ErrAmountBelowMinimum = errors.New("amount below the minimum transfer amount")
+
+//ErrCurrencyMismatch is returned by TransferTx when an account isn't in arg.Currency,
+//e.g. its currency was changed after the caller checked it
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+//ErrLockTimeout is returned by transactions that waited longer than the store's lock timeout for a row lock
+//nothing was written, the transaction can be retried once the contention is over
+var ErrLockTimeout = errors.New("timed out waiting for a row lock")
+
+//ErrClientIDReused is returned by TransferTx when the client id belongs to a different transfer
+var ErrClientIDReused = errors.New("client id already used for a different transfer")
+
+//ErrExternalReferenceReused is returned by TransferTx when the sender already used the external reference for a different transfer
+var ErrExternalReferenceReused = errors.New("external reference already used for a different transfer")
+
+//AccountBatchError is returned by CreateAccountsTx, Index is the position in args of the account that failed
+type AccountBatchError struct {
+	Index int
+	Err error
+}
+
+func (e *AccountBatchError) Error() string {
+	return fmt.Sprintf("account %d: %v", e.Index, e.Err)
+}
+
+func (e *AccountBatchError) Unwrap() error {
+	return e.Err
+}
+
+//postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	ForeignKeyViolation = "23503"
+	UniqueViolation     = "23505"
+	LockNotAvailable    = "55P03"
+	AdminShutdown       = "57P01"
+	CrashShutdown       = "57P02"
+	CannotConnectNow    = "57P03"
+)
+
+//names of the unique constraints on accounts, to tell apart which one a violation hit
+const (
+	OwnerCurrencyKey = "owner_currency_key"
+	OwnerNameKey     = "owner_name_key"
+	AccountNumberKey = "account_number_key"
+)
+
+//TransferDistinctAccounts is the check constraint keeping a transfer from sending money to its own account
+const TransferDistinctAccounts = "transfer_distinct_accounts"
+
+//ErrorCode returns the postgres error code of err, or an empty string if err is not a postgres error
+func ErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+//IsUniqueViolation reports whether err was caused by a unique constraint
+func IsUniqueViolation(err error) bool {
+	return ErrorCode(err) == UniqueViolation
+}
+
+//IsConstraintViolation reports whether err was caused by the named constraint
+func IsConstraintViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == constraint
+}
+
+//IsForeignKeyViolation reports whether err was caused by a foreign key constraint
+func IsForeignKeyViolation(err error) bool {
+	return ErrorCode(err) == ForeignKeyViolation
+}
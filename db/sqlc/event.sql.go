@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: event.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createEvent = `-- name: CreateEvent :one
+INSERT INTO events (
+  event_type, payload
+) VALUES (
+  $1, $2
+)
+RETURNING id, event_type, payload, created_at, processed_at
+`
+
+type CreateEventParams struct {
+	EventType string `json:"event_type"`
+	Payload   []byte `json:"payload"`
+}
+
+func (q *Queries) CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error) {
+	row := q.db.QueryRow(ctx, createEvent, arg.EventType, arg.Payload)
+	var i Event
+	err := row.Scan(
+		&i.ID,
+		&i.EventType,
+		&i.Payload,
+		&i.CreatedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const listUnprocessedEvents = `-- name: ListUnprocessedEvents :many
+SELECT id, event_type, payload, created_at, processed_at FROM events
+WHERE processed_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED
+`
+
+func (q *Queries) ListUnprocessedEvents(ctx context.Context, limit int32) ([]Event, error) {
+	rows, err := q.db.Query(ctx, listUnprocessedEvents, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Event{}
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.Payload,
+			&i.CreatedAt,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEventProcessed = `-- name: MarkEventProcessed :exec
+UPDATE events
+SET processed_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) MarkEventProcessed(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markEventProcessed, id)
+	return err
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//TestGeneratedCodeUpToDate fails when a query or migration was edited without running make sqlc
+func TestGeneratedCodeUpToDate(t *testing.T) {
+	if _, err := exec.LookPath("sqlc"); err != nil {
+		t.Skip("sqlc is not installed")
+	}
+
+	//sqlc diff compares what generate would write against the committed files
+	cmd := exec.Command("sqlc", "diff")
+	cmd.Dir = "../.."
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "generated code is out of date, run make sqlc:\n%s", out)
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+//AvailableBalance is the part of the balance not reserved by pending transfers
+func (account Account) AvailableBalance() int64 {
+	return account.Balance - account.HeldBalance
+}
+
+type AuthorizeTxParams struct {
+	FromAccountID int64 `json:"from_account_id"`
+	ToAccountID int64 `json:"to_account_id"`
+	Amount int64 `json:"amount"`
+	Description pgtype.Text `json:"description"`
+}
+
+type AuthorizeTxResult struct {
+	Transfer Transfer `json:"transfer"`
+	FromAccount Account `json:"from_account"`
+}
+
+//AuthorizeTx places a hold for a transfer without moving any money
+// it creates a pending transfer and reserves the amount in the sender's held_balance
+// it fails with ErrInsufficientBalance if the sender's available balance would go negative
+func (store *SQLStore) AuthorizeTx(ctx context.Context, arg AuthorizeTxParams) (AuthorizeTxResult, error) {
+	var result AuthorizeTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
+			FromAccountID: arg.FromAccountID,
+			ToAccountID: arg.ToAccountID,
+			Amount: arg.Amount,
+			Description: arg.Description,
+			Status: TransferStatusPending,
+		})
+		if err != nil {
+			return err
+		}
+
+		//only the sender is locked, so there is no lock ordering to respect
+		result.FromAccount, err = q.AddAccountHeldBalance(ctx, AddAccountHeldBalanceParams{
+			ID: arg.FromAccountID,
+			Amount: arg.Amount,
+		})
+		if err != nil {
+			return err
+		}
+
+		if result.FromAccount.AvailableBalance() < 0 {
+			return ErrInsufficientBalance
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+//CaptureTx finalizes a pending transfer placed by AuthorizeTx
+// it completes the transfer, writes its transfer.created event, adds the account entries, moves the money and releases the hold
+// it fails with ErrRecordNotFound if the transfer doesn't exist or isn't pending
+func (store *SQLStore) CaptureTx(ctx context.Context, transferID int64) (TransferTxResult, error) {
+	var result TransferTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		//locks the transfer row, so a hold can only be captured or voided once
+		result.Transfer, err = q.UpdateTransferStatus(ctx, UpdateTransferStatusParams{
+			ID: transferID,
+			Status: TransferStatusCompleted,
+		})
+		if err != nil {
+			return err
+		}
+		transfer := result.Transfer
+
+		//the transfer only completes now, so this is where downstream consumers hear of it, like from TransferTx
+		err = createTransferEvent(ctx, q, transfer)
+		if err != nil {
+			return err
+		}
+
+		transferID := pgtype.Int8{Int64: transfer.ID, Valid: true}
+		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
+			AccountID: transfer.FromAccountID,
+			Amount: -transfer.Amount,
+			TransferID: transferID,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
+			AccountID: transfer.ToAccountID,
+			Amount: transfer.Amount,
+			TransferID: transferID,
+		})
+		if err != nil {
+			return err
+		}
+
+		accounts, err := addMoney(ctx, q, store.lockingMode, []AddAccountBalanceParams{
+			{ID: transfer.FromAccountID, Amount: -transfer.Amount},
+			{ID: transfer.ToAccountID, Amount: transfer.Amount},
+		})
+		if err != nil {
+			return err
+		}
+		result.ToAccount = accounts[transfer.ToAccountID]
+
+		//both accounts are already locked in id order, so releasing the hold can't deadlock
+		result.FromAccount, err = q.AddAccountHeldBalance(ctx, AddAccountHeldBalanceParams{
+			ID: transfer.FromAccountID,
+			Amount: -transfer.Amount,
+		})
+		return err
+	})
+
+	return result, err
+}
+
+//VoidTx cancels a pending transfer placed by AuthorizeTx
+// it marks the transfer failed and releases the hold, no money is moved
+// it fails with ErrRecordNotFound if the transfer doesn't exist or isn't pending
+func (store *SQLStore) VoidTx(ctx context.Context, transferID int64) (AuthorizeTxResult, error) {
+	var result AuthorizeTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.Transfer, err = q.UpdateTransferStatus(ctx, UpdateTransferStatusParams{
+			ID: transferID,
+			Status: TransferStatusFailed,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.FromAccount, err = q.AddAccountHeldBalance(ctx, AddAccountHeldBalanceParams{
+			ID: result.Transfer.FromAccountID,
+			Amount: -result.Transfer.Amount,
+		})
+		return err
+	})
+
+	return result, err
+}
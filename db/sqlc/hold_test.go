@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func authorizeRandomHold(t *testing.T, store Store, amount int64) (Account, Account, AuthorizeTxResult) {
+	account1 := createFundedAccount(t, 100)
+	account2 := createRandomAccount(t)
+
+	result, err := store.AuthorizeTx(context.Background(), AuthorizeTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: amount,
+	})
+	require.NoError(t, err)
+	require.Equal(t, TransferStatusPending, result.Transfer.Status)
+	require.Equal(t, amount, result.Transfer.Amount)
+
+	//the money stays in the balance but is no longer available
+	require.Equal(t, account1.Balance, result.FromAccount.Balance)
+	require.Equal(t, amount, result.FromAccount.HeldBalance)
+	require.Equal(t, account1.Balance-amount, result.FromAccount.AvailableBalance())
+	return account1, account2, result
+}
+
+func TestAuthorizeCaptureTx(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1, account2, hold := authorizeRandomHold(t, store, 60)
+
+	result, err := store.CaptureTx(context.Background(), hold.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, TransferStatusCompleted, result.Transfer.Status)
+	require.Equal(t, int64(-60), result.FromEntry.Amount)
+	require.Equal(t, int64(60), result.ToEntry.Amount)
+
+	require.Equal(t, account1.Balance-60, result.FromAccount.Balance)
+	require.Zero(t, result.FromAccount.HeldBalance)
+	require.Equal(t, account2.Balance+60, result.ToAccount.Balance)
+
+	//a captured hold can't be captured or voided again
+	_, err = store.CaptureTx(context.Background(), hold.Transfer.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	_, err = store.VoidTx(context.Background(), hold.Transfer.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestCaptureTxRelaysEvent(t *testing.T) {
+	store := NewStore(testDB, nil)
+	_, _, hold := authorizeRandomHold(t, store, 30)
+
+	var published []Transfer
+	publish := func(event Event) error {
+		require.Equal(t, EventTransferCreated, event.EventType)
+		var transfer Transfer
+		require.NoError(t, json.Unmarshal(event.Payload, &transfer))
+		published = append(published, transfer)
+		return nil
+	}
+	drain := func() {
+		published = nil
+		for {
+			relayed, err := store.RelayEvents(context.Background(), 100, publish)
+			require.NoError(t, err)
+			if relayed == 0 {
+				return
+			}
+		}
+	}
+
+	//a hold isn't a transfer yet, earlier tests may have left events of their own
+	drain()
+	for _, transfer := range published {
+		require.NotEqual(t, hold.Transfer.ID, transfer.ID)
+	}
+
+	result, err := store.CaptureTx(context.Background(), hold.Transfer.ID)
+	require.NoError(t, err)
+
+	drain()
+	require.NotEmpty(t, published)
+	captured := published[len(published)-1]
+	require.Equal(t, result.Transfer.ID, captured.ID)
+	require.Equal(t, TransferStatusCompleted, captured.Status)
+}
+
+func TestAuthorizeVoidTx(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1, account2, hold := authorizeRandomHold(t, store, 60)
+
+	result, err := store.VoidTx(context.Background(), hold.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, TransferStatusFailed, result.Transfer.Status)
+	require.Equal(t, account1.Balance, result.FromAccount.Balance)
+	require.Zero(t, result.FromAccount.HeldBalance)
+
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance, updatedAccount2.Balance)
+
+	_, err = store.CaptureTx(context.Background(), hold.Transfer.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestAuthorizeTxInsufficientBalance(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1, account2, _ := authorizeRandomHold(t, store, 60)
+
+	//held funds can't be spent by another hold or by a transfer
+	_, err := store.AuthorizeTx(context.Background(), AuthorizeTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 50,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 50,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(60), updatedAccount1.HeldBalance)
+}
@@ -1,28 +1,69 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"log"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/TriNgoc2077/Simple-Bank/util"
-	_ "github.com/lib/pq"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
 )
 
 var testQueries *Queries
-var testDB *sql.DB
+var testDB *pgxpool.Pool
 
+//TestMain starts a throwaway postgres container, migrates it up and runs the tests against it
 func TestMain(m *testing.M) {
-	config, err := util.LoadConfig("../..")
-		if err != nil {
-		log.Fatal("cannot load config: ", err)
+	ctx := context.Background()
+
+	container, err := postgres.Run(ctx, "postgres:17-alpine",
+		postgres.WithDatabase("simple_bank"),
+		postgres.WithUsername("root"),
+		postgres.WithPassword("secret"),
+		postgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		log.Fatal("cannot start postgres container: ", err)
+	}
+
+	dbSource, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Fatal("cannot get connection string: ", err)
+	}
+
+	//golang-migrate selects its pgx driver by the pgx5 scheme
+	migration, err := migrate.New("file://../migration", strings.Replace(dbSource, "postgres://", "pgx5://", 1))
+	if err != nil {
+		log.Fatal("cannot create migration: ", err)
+	}
+	if err = migration.Up(); err != nil && err != migrate.ErrNoChange {
+		log.Fatal("cannot run migration up: ", err)
 	}
-	testDB, err = sql.Open(config.DBDriver, config.DBSource)
+
+	//the tests run under the default statement timeout, so TransferTx is checked against it
+	poolConfig, err := NewPoolConfig(dbSource, util.DefaultDBStatementTimeout)
+	if err != nil {
+		log.Fatal("cannot parse db source:", err)
+	}
+	testDB, err = pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		log.Fatal("cannot connect to db:", err)
 	}
 	testQueries = New(testDB)
 
-	os.Exit(m.Run())
-}
\ No newline at end of file
+	code := m.Run()
+
+	//os.Exit skips deferred calls, so tear down explicitly
+	testDB.Close()
+	if err := testcontainers.TerminateContainer(container); err != nil {
+		log.Print("cannot terminate postgres container: ", err)
+	}
+	os.Exit(code)
+}
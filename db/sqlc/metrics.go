@@ -0,0 +1,21 @@
+package db
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//transfersInFlight counts TransferTx calls that have started and not yet committed or rolled back
+//when it sits near the pool size, transfers are waiting on connections
+var transfersInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "simplebank",
+	Name: "transfers_in_flight",
+	Help: "Number of TransferTx operations currently executing.",
+})
+
+//readRetries counts reads that lost their connection and were run again, see retryRead
+var readRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "simplebank",
+	Name: "db_read_retries_total",
+	Help: "Number of idempotent reads retried after a dead database connection.",
+})
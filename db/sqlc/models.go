@@ -5,15 +5,79 @@
 package db
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type TransferStatus string
+
+const (
+	TransferStatusPending   TransferStatus = "pending"
+	TransferStatusCompleted TransferStatus = "completed"
+	TransferStatusFailed    TransferStatus = "failed"
+)
+
+func (e *TransferStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = TransferStatus(s)
+	case string:
+		*e = TransferStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for TransferStatus: %T", src)
+	}
+	return nil
+}
+
+type NullTransferStatus struct {
+	TransferStatus TransferStatus `json:"transfer_status"`
+	Valid          bool           `json:"valid"` // Valid is true if TransferStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullTransferStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.TransferStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.TransferStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullTransferStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.TransferStatus), nil
+}
+
 type Account struct {
 	ID        int64     `json:"id"`
 	Owner     string    `json:"owner"`
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	// funds reserved by pending transfers, available balance = balance - held_balance
+	HeldBalance int64       `json:"held_balance"`
+	Name        pgtype.Text `json:"name"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	// public identifier given to clients, joins keep using id
+	AccountNumber string `json:"account_number"`
+	// free-form client labels, always a JSON object
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+type BalanceSnapshot struct {
+	AccountID    int64       `json:"account_id"`
+	SnapshotDate pgtype.Date `json:"snapshot_date"`
+	// balance at the end of snapshot_date
+	Balance   int64     `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Entry struct {
@@ -22,6 +86,16 @@ type Entry struct {
 	// can be negative or positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// the transfer that wrote the entry, NULL for opening balances and for entries written before this column
+	TransferID pgtype.Int8 `json:"transfer_id"`
+}
+
+type Event struct {
+	ID          int64            `json:"id"`
+	EventType   string           `json:"event_type"`
+	Payload     []byte           `json:"payload"`
+	CreatedAt   time.Time        `json:"created_at"`
+	ProcessedAt pgtype.Timestamp `json:"processed_at"`
 }
 
 type Transfer struct {
@@ -31,4 +105,16 @@ type Transfer struct {
 	// must be positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// optional note from the sender
+	Description pgtype.Text `json:"description"`
+	// charged to the sender on top of amount
+	Fee int64 `json:"fee"`
+	// pending transfers can move to completed or failed
+	Status TransferStatus `json:"status"`
+	// client supplied id, a retried insert returns the existing transfer
+	ClientID pgtype.UUID `json:"client_id"`
+	// optional label for budgeting, filterable on the account statement
+	Category pgtype.Text `json:"category"`
+	// client supplied reference for reconciliation, unique per sending account
+	ExternalReference pgtype.Text `json:"external_reference"`
 }
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+)
+
+//EventTransferCreated is written by TransferTx and CaptureTx for every completed transfer, its payload is the transfer
+const EventTransferCreated = "transfer.created"
+
+//createTransferEvent records the transfer in the outbox, it must run in the transaction that created the transfer
+func createTransferEvent(ctx context.Context, q *Queries, transfer Transfer) error {
+	payload, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateEvent(ctx, CreateEventParams{
+		EventType: EventTransferCreated,
+		Payload: payload,
+	})
+	return err
+}
+
+//RelayEvents passes up to limit unprocessed events to publish in id order and marks them processed
+//the events stay locked until the batch commits, so concurrent relays never publish the same event
+//an error from publish rolls the batch back and its events are retried on the next call,
+//so a consumer can see an event twice if the commit fails after publishing, and should dedupe by event id
+func (store *SQLStore) RelayEvents(ctx context.Context, limit int32, publish func(Event) error) (int, error) {
+	var relayed int
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		events, err := q.ListUnprocessedEvents(ctx, limit)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := publish(event); err != nil {
+				return err
+			}
+			if err := q.MarkEventProcessed(ctx, event.ID); err != nil {
+				return err
+			}
+		}
+		relayed = len(events)
+		return nil
+	})
+
+	return relayed, err
+}
@@ -0,0 +1,19 @@
+package db
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//NewPoolConfig parses dbURL and sets statement_timeout on every connection the pool opens
+//postgres then cancels a runaway query itself instead of leaving its goroutine hanging, 0 disables the limit
+func NewPoolConfig(dbURL string, statementTimeout time.Duration) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(statementTimeout.Milliseconds(), 10)
+	return poolConfig, nil
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolStatementTimeout(t *testing.T) {
+	var timeout string
+	err := testDB.QueryRow(context.Background(), "SHOW statement_timeout").Scan(&timeout)
+	require.NoError(t, err)
+	require.Equal(t, "30s", timeout)
+}
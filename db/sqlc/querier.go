@@ -0,0 +1,76 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Querier interface {
+	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	AddAccountHeldBalance(ctx context.Context, arg AddAccountHeldBalanceParams) (Account, error)
+	CountAccountTransfers(ctx context.Context, arg CountAccountTransfersParams) (CountAccountTransfersRow, error)
+	CountAccounts(ctx context.Context, arg CountAccountsParams) (int64, error)
+	CountEntriesByAccount(ctx context.Context, arg CountEntriesByAccountParams) (int64, error)
+	CountTransfersByAccount(ctx context.Context, arg CountTransfersByAccountParams) (int64, error)
+	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	// the job may run well after midnight, so the balance is rolled back by the entries made since the day ended
+	// one statement reads one snapshot, balances and entries always agree
+	// taking the same day again changes nothing
+	CreateBalanceSnapshots(ctx context.Context, snapshotDate pgtype.Date) (int64, error)
+	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error)
+	// no target, so a taken client id and a taken external reference both return no row
+	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
+	DeleteAccount(ctx context.Context, id int64) error
+	DeleteEntry(ctx context.Context, id int64) error
+	GetAccount(ctx context.Context, id int64) (Account, error)
+	GetAccountByNumber(ctx context.Context, accountNumber string) (Account, error)
+	GetAccountByOwnerCurrency(ctx context.Context, arg GetAccountByOwnerCurrencyParams) (Account, error)
+	GetAccountByOwnerName(ctx context.Context, arg GetAccountByOwnerNameParams) (Account, error)
+	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
+	GetAccountMetadata(ctx context.Context, id int64) (json.RawMessage, error)
+	// the latest snapshot on or before as_of, its snapshot_date says which day it is for
+	GetBalanceSnapshotAsOf(ctx context.Context, arg GetBalanceSnapshotAsOfParams) (BalanceSnapshot, error)
+	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetEntryTotals(ctx context.Context, arg GetEntryTotalsParams) (GetEntryTotalsRow, error)
+	GetLastTransferByAccount(ctx context.Context, accountID int64) (Transfer, error)
+	GetTransfer(ctx context.Context, id int64) (Transfer, error)
+	GetTransferByClientID(ctx context.Context, clientID pgtype.UUID) (Transfer, error)
+	GetTransferByExternalReference(ctx context.Context, arg GetTransferByExternalReferenceParams) (Transfer, error)
+	GetTransferWithAccounts(ctx context.Context, id int64) (GetTransferWithAccountsRow, error)
+	ListAccountBalanceDrift(ctx context.Context) ([]ListAccountBalanceDriftRow, error)
+	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
+	ListAccountsByIDs(ctx context.Context, arg ListAccountsByIDsParams) ([]Account, error)
+	ListEntriesByAccount(ctx context.Context, arg ListEntriesByAccountParams) ([]Entry, error)
+	ListEntry(ctx context.Context, arg ListEntryParams) ([]Entry, error)
+	// the CSV statement: every completed transfer of the account in the range, plus its opening balance
+	// and the fees it collected on other accounts' transfers, oldest first
+	// amount is the signed change to the account's balance, StreamStatementLines reads it without buffering
+	// pending and failed transfers never moved money, so they are left out
+	// the opening balance is the entry written in the account's own transaction, which shares its now(),
+	// other entries without a transfer_id predate the column and are already covered by their transfer's line
+	ListStatementLines(ctx context.Context, arg ListStatementLinesParams) ([]ListStatementLinesRow, error)
+	// every transfer of the account in the range with both accounts, oldest first, StreamStatementTransfers reads it without buffering
+	ListStatementTransfers(ctx context.Context, arg ListStatementTransfersParams) ([]ListStatementTransfersRow, error)
+	ListTransfer(ctx context.Context, arg ListTransferParams) ([]Transfer, error)
+	ListTransferBetweenAccounts(ctx context.Context, arg ListTransferBetweenAccountsParams) ([]Transfer, error)
+	ListTransferFromAccount(ctx context.Context, arg ListTransferFromAccountParams) ([]Transfer, error)
+	ListTransfersByAccount(ctx context.Context, arg ListTransfersByAccountParams) ([]Transfer, error)
+	ListTransfersWithAccounts(ctx context.Context, arg ListTransfersWithAccountsParams) ([]ListTransfersWithAccountsRow, error)
+	ListUnprocessedEvents(ctx context.Context, limit int32) ([]Event, error)
+	MarkEventProcessed(ctx context.Context, id int64) error
+	SetAccountMetadata(ctx context.Context, arg SetAccountMetadataParams) (Account, error)
+	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
+	UpdateAccountCurrency(ctx context.Context, arg UpdateAccountCurrencyParams) (Account, error)
+	UpdateAccountName(ctx context.Context, arg UpdateAccountNameParams) (Account, error)
+	UpdateEntry(ctx context.Context, arg UpdateEntryParams) (Entry, error)
+	UpdateTransferStatus(ctx context.Context, arg UpdateTransferStatusParams) (Transfer, error)
+}
+
+var _ Querier = (*Queries)(nil)
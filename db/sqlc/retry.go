@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//readRetryDelay gives the pool a moment to replace a dead connection before the read runs again
+const readRetryDelay = 50 * time.Millisecond
+
+//retryRead runs an idempotent read, and once more if the first attempt failed on a dead connection
+//pgxpool destroys a broken connection when it's released, so the second attempt gets a fresh one
+//only reads may go through here: a write whose connection died may still have committed
+func retryRead[T any](ctx context.Context, read func(context.Context) (T, error)) (T, error) {
+	result, err := read(ctx)
+	if !isConnectionError(err) {
+		return result, err
+	}
+	select {
+	case <-ctx.Done():
+		return result, err
+	case <-time.After(readRetryDelay):
+	}
+	readRetries.Inc()
+	return read(ctx)
+}
+
+//isConnectionError reports whether err means the connection to the database went away,
+//as opposed to the query itself failing, the server shutting down counts too
+//a canceled or timed out context is the caller giving up, not a dead connection
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	code := ErrorCode(err)
+	if code != "" {
+		//class 08 is connection exception
+		return strings.HasPrefix(code, "08") || code == AdminShutdown || code == CrashShutdown || code == CannotConnectNow
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &connectErr) || errors.As(err, &netErr)
+}
+
+//accountNumberAttempts is how many times creating accounts is tried while the drawn account numbers are taken
+const accountNumberAttempts = 3
+
+//retryAccountNumber runs createAccounts again while it fails on account_number_key
+//the number is 12 random digits drawn by the column default, so every run draws new ones,
+//and the failed transaction was rolled back, so nothing of it is left to clean up
+func retryAccountNumber[T any](createAccounts func() (T, error)) (T, error) {
+	var result T
+	var err error
+	for range accountNumberAttempts {
+		result, err = createAccounts()
+		if !IsConstraintViolation(err, AccountNumberKey) {
+			break
+		}
+	}
+	return result, err
+}
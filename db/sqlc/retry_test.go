@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	testCases := []struct {
+		name string
+		err error
+		want bool
+	}{
+		{name: "Nil", err: nil, want: false},
+		{name: "BadConn", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "UnexpectedEOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "AdminShutdown", err: &pgconn.PgError{Code: AdminShutdown}, want: true},
+		{name: "ConnectionFailure", err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "UniqueViolation", err: &pgconn.PgError{Code: UniqueViolation}, want: false},
+		{name: "NotFound", err: ErrRecordNotFound, want: false},
+		{name: "Canceled", err: context.Canceled, want: false},
+		{name: "DeadlineExceeded", err: context.DeadlineExceeded, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, isConnectionError(tc.err))
+		})
+	}
+}
+
+func TestRetryRead(t *testing.T) {
+	//read fails with errs in turn, then succeeds
+	flaky := func(errs ...error) (func(context.Context) (int, error), *int) {
+		calls := 0
+		return func(ctx context.Context) (int, error) {
+			calls++
+			if calls <= len(errs) {
+				return 0, errs[calls-1]
+			}
+			return 42, nil
+		}, &calls
+	}
+
+	//a transient failure is retried once
+	read, calls := flaky(driver.ErrBadConn)
+	got, err := retryRead(context.Background(), read)
+	require.NoError(t, err)
+	require.Equal(t, 42, got)
+	require.Equal(t, 2, *calls)
+
+	//but only once
+	read, calls = flaky(driver.ErrBadConn, driver.ErrBadConn)
+	_, err = retryRead(context.Background(), read)
+	require.ErrorIs(t, err, driver.ErrBadConn)
+	require.Equal(t, 2, *calls)
+
+	//query errors are the answer, not a reason to retry
+	read, calls = flaky(ErrRecordNotFound)
+	_, err = retryRead(context.Background(), read)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	require.Equal(t, 1, *calls)
+
+	//a caller that gave up doesn't wait for the retry
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	read, calls = flaky(driver.ErrBadConn)
+	_, err = retryRead(ctx, read)
+	require.ErrorIs(t, err, driver.ErrBadConn)
+	require.Equal(t, 1, *calls)
+}
+
+//TestGetAccountAfterConnectionLoss kills the only connection of a pool behind the store's back,
+//the next read hits the dead connection and is retried on a new one
+func TestGetAccountAfterConnectionLoss(t *testing.T) {
+	ctx := context.Background()
+	account := createRandomAccount(t)
+
+	poolConfig, err := pgxpool.ParseConfig(testDB.Config().ConnString())
+	require.NoError(t, err)
+	poolConfig.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	require.NoError(t, err)
+	defer pool.Close()
+	store := NewStore(pool, nil)
+
+	killConn := func() {
+		var pid uint32
+		require.NoError(t, pool.QueryRow(ctx, "SELECT pg_backend_pid()").Scan(&pid))
+		var terminated bool
+		require.NoError(t, testDB.QueryRow(ctx, "SELECT pg_terminate_backend($1, 5000)", pid).Scan(&terminated))
+		require.True(t, terminated)
+	}
+
+	//a plain query on the dead connection fails
+	killConn()
+	_, err = New(pool).GetAccount(ctx, account.ID)
+	require.True(t, isConnectionError(err), "%v", err)
+
+	killConn()
+	start := time.Now()
+	got, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.ID, got.ID)
+	require.GreaterOrEqual(t, time.Since(start), readRetryDelay)
+
+	//writes are never retried
+	killConn()
+	_, err = store.UpdateAccount(ctx, UpdateAccountParams{ID: account.ID, Balance: account.Balance})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrRecordNotFound))
+}
+
+func TestRetryAccountNumber(t *testing.T) {
+	taken := &pgconn.PgError{Code: UniqueViolation, ConstraintName: AccountNumberKey}
+	ownerCurrency := &pgconn.PgError{Code: UniqueViolation, ConstraintName: OwnerCurrencyKey}
+
+	testCases := []struct {
+		name string
+		errs []error
+		calls int
+		err error
+	}{
+		{name: "OK", calls: 1},
+		{name: "NumberTakenOnce", errs: []error{taken}, calls: 2},
+		//the batch wraps it in an AccountBatchError
+		{name: "NumberTakenInBatch", errs: []error{&AccountBatchError{Index: 1, Err: taken}}, calls: 2},
+		{name: "NumberAlwaysTaken", errs: []error{taken, taken, taken}, calls: accountNumberAttempts, err: taken},
+		{name: "OtherConstraint", errs: []error{ownerCurrency}, calls: 1, err: ownerCurrency},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			result, err := retryAccountNumber(func() (int, error) {
+				calls++
+				if calls <= len(tc.errs) {
+					return 0, tc.errs[calls-1]
+				}
+				return 42, nil
+			})
+			require.Equal(t, tc.calls, calls)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 42, result)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+//SnapshotDate is the day a balance snapshot taken at now is for: the last day that has fully passed, in UTC
+func SnapshotDate(now time.Time) pgtype.Date {
+	year, month, day := now.UTC().AddDate(0, 0, -1).Date()
+	return pgtype.Date{Time: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), Valid: true}
+}
+
+//NextSnapshot is when the snapshot after now is due, the next UTC midnight
+func NextSnapshot(now time.Time) time.Time {
+	year, month, day := now.UTC().AddDate(0, 0, 1).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//statementRow flattens ListStatementTransfersRow for pgx.RowToStructByName, which matches the columns by name
+//so new transfers columns are picked up without touching the scan
+type statementRow struct {
+	Transfer
+	FromOwner string
+	FromCurrency string
+	ToOwner string
+	ToCurrency string
+}
+
+//StreamStatementTransfers passes the rows of ListStatementTransfers to fn as they are read from the read pool,
+//so a long statement is never held in memory, an error from fn stops the query and is returned
+func (store *SQLStore) StreamStatementTransfers(ctx context.Context, arg ListStatementTransfersParams, fn func(ListStatementTransfersRow) error) error {
+	rows, err := store.readQueries.db.Query(ctx, listStatementTransfers, arg.AccountID, arg.FromTime, arg.ToTime, arg.Status, arg.Category)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := pgx.RowToStructByName[statementRow](rows)
+		if err != nil {
+			return err
+		}
+		err = fn(ListStatementTransfersRow{
+			Transfer: row.Transfer,
+			FromOwner: row.FromOwner,
+			FromCurrency: row.FromCurrency,
+			ToOwner: row.ToOwner,
+			ToCurrency: row.ToCurrency,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+//StreamStatementLines passes the rows of ListStatementLines to fn as they are read from the read pool, like StreamStatementTransfers
+func (store *SQLStore) StreamStatementLines(ctx context.Context, arg ListStatementLinesParams, fn func(ListStatementLinesRow) error) error {
+	rows, err := store.readQueries.db.Query(ctx, listStatementLines, arg.AccountID, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := pgx.RowToStructByName[ListStatementLinesRow](rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
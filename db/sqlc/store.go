@@ -2,44 +2,183 @@ package db
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type Store struct {
+//Store provides all functions to execute db queries and transactions
+type Store interface {
+	Querier
+	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	AuthorizeTx(ctx context.Context, arg AuthorizeTxParams) (AuthorizeTxResult, error)
+	CaptureTx(ctx context.Context, transferID int64) (TransferTxResult, error)
+	VoidTx(ctx context.Context, transferID int64) (AuthorizeTxResult, error)
+	CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (CreateAccountTxResult, error)
+	CreateAccountsTx(ctx context.Context, args []CreateAccountTxParams) ([]CreateAccountTxResult, error)
+	RelayEvents(ctx context.Context, limit int32, publish func(Event) error) (int, error)
+	StreamStatementTransfers(ctx context.Context, arg ListStatementTransfersParams, fn func(ListStatementTransfersRow) error) error
+	StreamStatementLines(ctx context.Context, arg ListStatementLinesParams, fn func(ListStatementLinesRow) error) error
+	Ping(ctx context.Context) error
+}
+
+//SQLStore provides all functions to execute SQL queries and transactions
+type SQLStore struct {
 	*Queries
-	db *sql.DB
+	readQueries *Queries
+	connPool *pgxpool.Pool
+	lockingMode LockingMode
+	lockTimeout time.Duration
+}
+
+//LockingMode picks how transactions lock and update account balances
+type LockingMode string
+
+const (
+	//LockingDelta runs UPDATE accounts SET balance = balance + amount, the UPDATE takes the row lock itself
+	LockingDelta LockingMode = "delta"
+	//LockingSelectForUpdate first locks the account with SELECT ... FOR NO KEY UPDATE, then writes the new balance
+	LockingSelectForUpdate LockingMode = "select_for_update"
+)
+
+//StoreOption configures an SQLStore in NewStore
+type StoreOption func(*SQLStore)
+
+//WithLockingMode sets the locking mode, the default is LockingDelta
+func WithLockingMode(mode LockingMode) StoreOption {
+	return func(store *SQLStore) {
+		store.lockingMode = mode
+	}
 }
 
-func NewStore(db *sql.DB) *Store {
-	return &Store{
-		db: db,
-		Queries: New(db),
+//WithLockTimeout bounds how long a transaction waits for a row lock, it then fails with ErrLockTimeout
+//the default, 0, waits until the statement timeout
+func WithLockTimeout(timeout time.Duration) StoreOption {
+	return func(store *SQLStore) {
+		store.lockTimeout = timeout
 	}
 }
 
+//NewStore creates a store that writes to connPool and serves read-only queries from readPool
+//if readPool is nil, read-only queries also go to connPool
+func NewStore(connPool *pgxpool.Pool, readPool *pgxpool.Pool, opts ...StoreOption) Store {
+	queries := New(connPool)
+	readQueries := queries
+	if readPool != nil {
+		readQueries = New(readPool)
+	}
+	store := &SQLStore{
+		connPool: connPool,
+		Queries: queries,
+		readQueries: readQueries,
+		lockingMode: LockingDelta,
+	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	return store
+}
+
+//Ping checks that the primary pool can reach the database
+func (store *SQLStore) Ping(ctx context.Context) error {
+	return store.connPool.Ping(ctx)
+}
+
+//GetAccount reads an account from the read pool, retrying once on a dead connection
+func (store *SQLStore) GetAccount(ctx context.Context, id int64) (Account, error) {
+	return retryRead(ctx, func(ctx context.Context) (Account, error) {
+		return store.readQueries.GetAccount(ctx, id)
+	})
+}
+
+//ListAccountsByIDs reads the accounts among ids from the read pool, retrying once on a dead connection
+func (store *SQLStore) ListAccountsByIDs(ctx context.Context, arg ListAccountsByIDsParams) ([]Account, error) {
+	return retryRead(ctx, func(ctx context.Context) ([]Account, error) {
+		return store.readQueries.ListAccountsByIDs(ctx, arg)
+	})
+}
+
+//ListAccounts lists accounts from the read pool, retrying once on a dead connection
+func (store *SQLStore) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
+	return retryRead(ctx, func(ctx context.Context) ([]Account, error) {
+		return store.readQueries.ListAccounts(ctx, arg)
+	})
+}
+
 //execTx executes a function within a database transaction
-func (store *Store) execTx(ctx context.Context, fn func(*Queries) error) error {
-	tx, err := store.db.BeginTx(ctx, nil)
+//the store's lock timeout applies to every lock the transaction takes, both the SELECT ... FOR NO KEY UPDATE
+//of select_for_update mode and the row lock the UPDATE takes in delta mode
+func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
+	tx, err := store.connPool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 
 	q := New(tx)
-	err = fn(q)
+	if store.lockTimeout > 0 {
+		err = setLockTimeout(ctx, tx, store.lockTimeout)
+	}
+	if err == nil {
+		err = fn(q)
+	}
+	if ErrorCode(err) == LockNotAvailable {
+		err = fmt.Errorf("%w: %v", ErrLockTimeout, err)
+	}
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
 			return fmt.Errorf("tx Err: %v, rb Err: %v", err, rbErr)
 		}
 		return err
 	}
-	return tx.Commit()
+	return tx.Commit(ctx)
+}
+
+//setLockTimeout sets lock_timeout for the rest of tx only, the pooled connection keeps its default
+//postgres reads a bare number as milliseconds, and 0 would disable the timeout, so it's at least 1ms
+func setLockTimeout(ctx context.Context, tx pgx.Tx, timeout time.Duration) error {
+	ms := max(timeout.Milliseconds(), 1)
+	_, err := tx.Exec(ctx, "SELECT set_config('lock_timeout', $1, true)", strconv.FormatInt(ms, 10))
+	return err
+}
+
+//TransferFee describes the fee charged to the sender of a transfer
+//the fee is Fixed plus BasisPoints/10000 of the amount, and it is credited to AccountID
+type TransferFee struct {
+	Fixed int64
+	BasisPoints int64
+	AccountID int64
+}
+
+//Compute returns the fee for a transfer of amount, or 0 when no fee account is set
+func (fee TransferFee) Compute(amount int64) int64 {
+	if fee.AccountID == 0 {
+		return 0
+	}
+	return fee.Fixed + amount*fee.BasisPoints/10000
 }
 
 type TransferTxParams struct {
 	FromAccountID int64 `json:"from_account_id"`
 	ToAccountID int64 `json:"to_account_id"`
-	Amount int64 `json:"amount`
+	Amount int64 `json:"amount"`
+	//Currency, when set, must be the currency of every account the transfer touches
+	//it's checked under the accounts' row locks, so a concurrent currency change can't slip in
+	Currency string `json:"currency"`
+	Description pgtype.Text `json:"description"`
+	Fee TransferFee `json:"-"`
+	//MinimumAmount is the smallest amount accepted, anything below 1 minor unit means 1
+	MinimumAmount int64 `json:"-"`
+	//ClientID, when valid, makes the transfer idempotent: a retry with the same id returns the first transfer
+	ClientID pgtype.UUID `json:"client_id"`
+	Category pgtype.Text `json:"category"`
+	//ExternalReference, when valid, is unique per sending account: reusing it returns the first transfer, like ClientID
+	ExternalReference pgtype.Text `json:"external_reference"`
 }
 
 type TransferTxResult struct {
@@ -48,12 +187,31 @@ type TransferTxResult struct {
 	ToAccount Account `json:"to_account"`
 	FromEntry Entry `json:"from_entry"`
 	ToEntry Entry `json:"to_entry"`
+	//the fee account is internal, so it is never serialized to clients
+	FeeAccount Account `json:"-"`
+	FeeEntry Entry `json:"-"`
+	//Replayed is set when the client id matched an earlier transfer, nothing was moved this time
+	//the entries are then left empty and the accounts hold their current balances
+	Replayed bool `json:"-"`
 }
 
 //TransferTx performs a money transfer from one account to the other
 // it create transfer record, add account entries, update account's balance within single database transaction
-func (store *Store) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+// it also writes a transfer.created event to the outbox for RelayEvents to publish
+// if arg.Fee applies, the sender is also debited the fee and the fee account is credited with it
+// it fails with ErrInsufficientBalance, rolling everything back, if the sender's available balance would go negative
+// and with ErrCurrencyMismatch if an account isn't in arg.Currency
+// if arg.ClientID or arg.ExternalReference was already used, the earlier transfer is returned instead, see replayTransfer
+// amounts below arg.MinimumAmount fail with ErrAmountBelowMinimum before the database is touched
+func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+	transfersInFlight.Inc()
+	defer transfersInFlight.Dec()
+
 	var result TransferTxResult
+	if arg.Amount < max(arg.MinimumAmount, 1) {
+		return result, ErrAmountBelowMinimum
+	}
+	fee := arg.Fee.Compute(arg.Amount)
 
 	err := store.execTx(ctx, func(q *Queries) error {
 		var err error
@@ -62,35 +220,87 @@ func (store *Store) TransferTx(ctx context.Context, arg TransferTxParams) (Trans
 			FromAccountID: arg.FromAccountID,
 			ToAccountID: arg.ToAccountID,
 			Amount: arg.Amount,
+			Description: arg.Description,
+			Fee: fee,
+			Status: TransferStatusCompleted,
+			ClientID: arg.ClientID,
+			Category: arg.Category,
+			ExternalReference: arg.ExternalReference,
 		})
+		if errors.Is(err, ErrRecordNotFound) && (arg.ClientID.Valid || arg.ExternalReference.Valid) {
+			//ON CONFLICT DO NOTHING returns no row when the client id or the reference is taken
+			return replayTransfer(ctx, q, arg, &result)
+		}
 		if err != nil {
 			return err
 		}
 
+		//written in the same transaction, so the event exists exactly when the transfer commits
+		err = createTransferEvent(ctx, q, result.Transfer)
+		if err != nil {
+			return err
+		}
+
+		//the entries point back at the transfer, so the statement can tell them from opening balances
+		transferID := pgtype.Int8{Int64: result.Transfer.ID, Valid: true}
 		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
 			AccountID: arg.FromAccountID,
-			Amount: -arg.Amount,
+			Amount: -(arg.Amount + fee),
+			TransferID: transferID,
 		})
 		if err != nil {
-			return nil
+			return err
 		}
 
 		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
 			AccountID: arg.ToAccountID,
 			Amount: arg.Amount,
+			TransferID: transferID,
 		})
 		if err != nil {
-			return nil
+			return err
 		}
 
+		updates := []AddAccountBalanceParams{
+			{ID: arg.FromAccountID, Amount: -(arg.Amount + fee)},
+			{ID: arg.ToAccountID, Amount: arg.Amount},
+		}
+
+		if fee > 0 {
+			result.FeeEntry, err = q.CreateEntry(ctx, CreateEntryParams{
+				AccountID: arg.Fee.AccountID,
+				Amount: fee,
+				TransferID: transferID,
+			})
+			if err != nil {
+				return err
+			}
+			updates = append(updates, AddAccountBalanceParams{ID: arg.Fee.AccountID, Amount: fee})
+		}
 
 		//get account -> update its balance
-		if arg.FromAccountID < arg.ToAccountID {
-			//update fromAccount first, then to account
-			result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount, arg.ToAccountID, arg.Amount)
-		} else {
-			//update toAccount, then fromAccount
-			result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount, arg.FromAccountID, -arg.Amount)
+		accounts, err := addMoney(ctx, q, store.lockingMode, updates)
+		if err != nil {
+			return err
+		}
+		result.FromAccount = accounts[arg.FromAccountID]
+		result.ToAccount = accounts[arg.ToAccountID]
+		if fee > 0 {
+			result.FeeAccount = accounts[arg.Fee.AccountID]
+		}
+
+		//the caller checked the currencies before the transaction, the rows could have changed since
+		if arg.Currency != "" {
+			for _, account := range accounts {
+				if account.Currency != arg.Currency {
+					return fmt.Errorf("account [%d] %w: %s vs %s", account.ID, ErrCurrencyMismatch, account.Currency, arg.Currency)
+				}
+			}
+		}
+
+		//checked after the update rather than before, so accounts are still locked in id order
+		if result.FromAccount.AvailableBalance() < 0 {
+			return ErrInsufficientBalance
 		}
 
 		return nil
@@ -99,28 +309,157 @@ func (store *Store) TransferTx(ctx context.Context, arg TransferTxParams) (Trans
 	return result, err
 }
 
-func addMoney(
-	ctx context.Context,
-	q *Queries,
-	accountID1 int64,
-	amount1 int64,
-	accountID2 int64,
-	amount2 int64,
-) (account1 Account, account2 Account, err error) {
-	account1, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID: accountID1,
-		Amount: amount1,
+//replayTransfer fills result with the transfer already created under arg.ClientID or arg.ExternalReference
+//a concurrent insert with the same id waits for the first one to commit, so the row is visible here
+func replayTransfer(ctx context.Context, q *Queries, arg TransferTxParams, result *TransferTxResult) error {
+	reused := ErrClientIDReused
+	//an invalid client id is NULL and matches nothing
+	transfer, err := q.GetTransferByClientID(ctx, arg.ClientID)
+	if errors.Is(err, ErrRecordNotFound) && arg.ExternalReference.Valid {
+		//the client id is new or missing, so the reference is what conflicted
+		reused = ErrExternalReferenceReused
+		transfer, err = q.GetTransferByExternalReference(ctx, GetTransferByExternalReferenceParams{
+			FromAccountID: arg.FromAccountID,
+			ExternalReference: arg.ExternalReference,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if transfer.FromAccountID != arg.FromAccountID || transfer.ToAccountID != arg.ToAccountID || transfer.Amount != arg.Amount {
+		return reused
+	}
+
+	result.Transfer = transfer
+	result.Replayed = true
+	result.FromAccount, err = q.GetAccount(ctx, transfer.FromAccountID)
+	if err != nil {
+		return err
+	}
+	result.ToAccount, err = q.GetAccount(ctx, transfer.ToAccountID)
+	return err
+}
+
+//lockOrder sorts the balance updates into the order their accounts get locked: smallest id first
+//every transaction locks accounts in the same order, so concurrent transfers can't deadlock (see TestTransferTxDeadlock)
+//the sort is stable, updates to the same account keep their order
+func lockOrder(updates []AddAccountBalanceParams) {
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].ID < updates[j].ID
+	})
+}
+
+//addMoney applies the balance updates in lockOrder and returns the updated accounts by id
+func addMoney(ctx context.Context, q *Queries, mode LockingMode, updates []AddAccountBalanceParams) (map[int64]Account, error) {
+	lockOrder(updates)
+
+	accounts := make(map[int64]Account, len(updates))
+	for _, update := range updates {
+		account, err := updateBalance(ctx, q, mode, update)
+		if err != nil {
+			return nil, err
+		}
+		accounts[update.ID] = account
+	}
+	return accounts, nil
+}
+
+//updateBalance applies one update with the given locking mode
+func updateBalance(ctx context.Context, q *Queries, mode LockingMode, update AddAccountBalanceParams) (Account, error) {
+	if mode != LockingSelectForUpdate {
+		return q.AddAccountBalance(ctx, update)
+	}
+
+	account, err := q.GetAccountForUpdate(ctx, update.ID)
+	if err != nil {
+		return Account{}, err
+	}
+	//the row stays locked until the transaction ends, so the balance read above is still current
+	return q.UpdateAccount(ctx, UpdateAccountParams{
+		ID: update.ID,
+		Balance: account.Balance + update.Amount,
+	})
+}
+
+type CreateAccountTxParams struct {
+	Owner string `json:"owner"`
+	Currency string `json:"currency"`
+	Name pgtype.Text `json:"name"`
+	InitialBalance int64 `json:"initial_balance"`
+}
+
+type CreateAccountTxResult struct {
+	Account Account `json:"account"`
+	//nil when the account was opened without an initial balance
+	OpeningEntry *Entry `json:"opening_entry,omitempty"`
+}
+
+//CreateAccountTx creates an account and, if it's opened with a balance, the matching opening entry
+//both are written in a single database transaction, so balance and entries never disagree
+//a drawn account number that's already taken is drawn again, see retryAccountNumber
+func (store *SQLStore) CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (CreateAccountTxResult, error) {
+	return retryAccountNumber(func() (CreateAccountTxResult, error) {
+		var result CreateAccountTxResult
+
+		err := store.execTx(ctx, func(q *Queries) error {
+			var err error
+			result, err = openAccount(ctx, q, arg)
+			return err
+		})
+
+		return result, err
+	})
+}
+
+//CreateAccountsTx creates every account of args like CreateAccountTx, all in one transaction
+//if any of them fails nothing is created, and the error is an *AccountBatchError with the index of the failing account
+func (store *SQLStore) CreateAccountsTx(ctx context.Context, args []CreateAccountTxParams) ([]CreateAccountTxResult, error) {
+	return retryAccountNumber(func() ([]CreateAccountTxResult, error) {
+		var results []CreateAccountTxResult
+
+		err := store.execTx(ctx, func(q *Queries) error {
+			results = make([]CreateAccountTxResult, 0, len(args))
+			for i, arg := range args {
+				result, err := openAccount(ctx, q, arg)
+				if err != nil {
+					return &AccountBatchError{Index: i, Err: err}
+				}
+				results = append(results, result)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	})
+}
+
+//openAccount creates the account and its opening entry, it must run in a transaction
+func openAccount(ctx context.Context, q *Queries, arg CreateAccountTxParams) (CreateAccountTxResult, error) {
+	var result CreateAccountTxResult
+	var err error
+
+	result.Account, err = q.CreateAccount(ctx, CreateAccountParams{
+		Owner: arg.Owner,
+		Balance: arg.InitialBalance,
+		Currency: arg.Currency,
+		Name: arg.Name,
 	})
 	if err != nil {
-		return
+		return result, err
 	}
 
-	account2, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID: accountID2,
-		Amount: amount2,
+	if arg.InitialBalance == 0 {
+		return result, nil
+	}
+	entry, err := q.CreateEntry(ctx, CreateEntryParams{
+		AccountID: result.Account.ID,
+		Amount: arg.InitialBalance,
 	})
 	if err != nil {
-		return
+		return result, err
 	}
-	return
-}
\ No newline at end of file
+	result.OpeningEntry = &entry
+	return result, nil
+}
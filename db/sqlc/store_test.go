@@ -2,9 +2,15 @@ package db
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,10 +24,22 @@ import (
 // => so it needs to acquire a lock to prevent conflicts and ensure the consistency of the data
 
 // SOLUTION: notice to postgres that the query won't update the primary key (ID) -> add FOR NO KEY UPDATE (line 16 of account.sql)
+//createFundedAccount creates a random account holding balance, so transfers out of it don't overdraw
+func createFundedAccount(t testing.TB, balance int64) Account {
+	account, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Balance:  balance,
+		Currency: util.RandomCurrency(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, balance, account.Balance)
+	return account
+}
+
 func TestTransferTx(t *testing.T) {
-	store := NewStore(testDB)
+	store := NewStore(testDB, nil)
 
-	account1 := createRandomAccount(t)
+	account1 := createFundedAccount(t, 1000)
 	account2 := createRandomAccount(t)
 	fmt.Println(">> Before:", account1.Balance, account2.Balance)
 
@@ -58,6 +76,7 @@ func TestTransferTx(t *testing.T) {
 		require.Equal(t, account1.ID, transfer.FromAccountID)
 		require.Equal(t, account2.ID, transfer.ToAccountID)
 		require.Equal(t, amount, transfer.Amount)
+		require.Equal(t, TransferStatusCompleted, transfer.Status)
 		require.NotZero(t, transfer.ID)
 		require.NotZero(t, transfer.CreatedAt)
 
@@ -120,57 +139,634 @@ func TestTransferTx(t *testing.T) {
 	require.Equal(t, account2.Balance+int64(n)*amount, updateAccount2.Balance)
 }
 
+func TestLockOrder(t *testing.T) {
+	testCases := []struct {
+		name string
+		updates []AddAccountBalanceParams
+		want []int64
+	}{
+		{
+			name: "SmallerFirst",
+			updates: []AddAccountBalanceParams{{ID: 1, Amount: -10}, {ID: 2, Amount: 10}},
+			want: []int64{1, 2},
+		},
+		{
+			name: "LargerFirst",
+			updates: []AddAccountBalanceParams{{ID: 2, Amount: -10}, {ID: 1, Amount: 10}},
+			want: []int64{1, 2},
+		},
+		{
+			name: "WithFeeAccount",
+			updates: []AddAccountBalanceParams{{ID: 5, Amount: -12}, {ID: 9, Amount: 10}, {ID: 3, Amount: 2}},
+			want: []int64{3, 5, 9},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lockOrder(tc.updates)
+
+			ids := make([]int64, len(tc.updates))
+			for i, update := range tc.updates {
+				ids[i] = update.ID
+			}
+			require.Equal(t, tc.want, ids)
+		})
+	}
+
+	//both directions of a transfer between the same pair lock in the same order
+	forward := []AddAccountBalanceParams{{ID: 7, Amount: -1}, {ID: 4, Amount: 1}}
+	backward := []AddAccountBalanceParams{{ID: 4, Amount: -1}, {ID: 7, Amount: 1}}
+	lockOrder(forward)
+	lockOrder(backward)
+	require.Equal(t, forward[0].ID, backward[0].ID)
+
+	//a self transfer keeps the debit before the credit
+	self := []AddAccountBalanceParams{{ID: 4, Amount: -1}, {ID: 4, Amount: 1}}
+	lockOrder(self)
+	require.Equal(t, int64(-1), self[0].Amount)
+}
+
 // DEADLOCK: concurrency 2 transfer: A account1 -> account2, B: account2 -> account1
 // first, the entry will be created to take money out of account1, so postgres lock account1 (A)
 // concurrently, the entry will be also created to take money out of account2 (B), so the account2 is also lock
 // after that, we create entry to deposit money into account 2 (A), but it's locked by (B)
 // similar with (B), we can't update account1 -> DEADLOCK
-//SOLUTION: application always acquire locks in a consistent order -> update account with smaller Id before (line 88 store.go) 
+//SOLUTION: application always acquire locks in a consistent order -> update account with smaller Id before (addMoney in store.go)
+//both locking modes must come out right, and deadlock free, under the same concurrency
 func TestTransferTxDeadlock(t *testing.T) {
-	store := NewStore(testDB)
+	for _, mode := range []LockingMode{LockingDelta, LockingSelectForUpdate} {
+		t.Run(string(mode), func(t *testing.T) {
+			store := NewStore(testDB, nil, WithLockingMode(mode))
+
+			account1 := createFundedAccount(t, 1000)
+			account2 := createFundedAccount(t, 1000)
+			fmt.Println(">> Before:", account1.Balance, account2.Balance)
+
+			//run n concurrent transfer transactions
+			n := 10
+			amount := int64(10)
+			errs := make(chan error)
+
+			for i := 0; i < n; i++ {
+				fromAccountID := account1.ID
+				toAccountID := account2.ID
+
+				if i % 2 == 1 {
+					fromAccountID = account2.ID
+					toAccountID = account1.ID
+				}
+				go func() {
+					ctx := context.Background()
+					_, err := store.TransferTx(ctx, TransferTxParams{
+						FromAccountID: fromAccountID,
+						ToAccountID: toAccountID,
+						Amount: amount,
+					})
+
+					errs <- err
+				}()
+			}
+			//check results
+			for i := 0; i < n; i++ {
+				err := <-errs
+				require.NoError(t, err)
+
+			}
+			//check the final update balance
+			updateAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+			require.NoError(t, err)
+
+			updateAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+			require.NoError(t, err)
+
+			fmt.Println(">> After:", account1.Balance, account2.Balance)
+			require.Equal(t, account1.Balance, updateAccount1.Balance)
+			require.Equal(t, account2.Balance, updateAccount2.Balance)
+		})
+	}
+}
 
-	account1 := createRandomAccount(t)
+//TestTransferTxConservation reads the total of both accounts over and over while transfers run between them
+//the total must never change, a transfer whose debit is visible without its credit would show up here
+//where the final balance checks above can't see it
+func TestTransferTxConservation(t *testing.T) {
+	for _, mode := range []LockingMode{LockingDelta, LockingSelectForUpdate} {
+		t.Run(string(mode), func(t *testing.T) {
+			store := NewStore(testDB, nil, WithLockingMode(mode))
+			account1 := createFundedAccount(t, 1000)
+			account2 := createFundedAccount(t, 1000)
+			total := account1.Balance + account2.Balance
+
+			//one statement sees one snapshot, two GetAccount calls could straddle a commit
+			sumBalances := func(ctx context.Context) (int64, error) {
+				var sum int64
+				err := testDB.QueryRow(ctx, "SELECT sum(balance)::bigint FROM accounts WHERE id = ANY($1)", []int64{account1.ID, account2.ID}).Scan(&sum)
+				return sum, err
+			}
+
+			n := 20
+			amount := int64(10)
+			errs := make(chan error)
+			for i := 0; i < n; i++ {
+				fromAccountID := account1.ID
+				toAccountID := account2.ID
+				if i % 2 == 1 {
+					fromAccountID = account2.ID
+					toAccountID = account1.ID
+				}
+				go func() {
+					_, err := store.TransferTx(context.Background(), TransferTxParams{
+						FromAccountID: fromAccountID,
+						ToAccountID: toAccountID,
+						Amount: amount,
+					})
+					errs <- err
+				}()
+			}
+
+			//the reader runs until every transfer is done and reports each total it saw
+			done := make(chan struct{})
+			sums := make(chan []int64)
+			readErr := make(chan error, 1)
+			go func() {
+				var seen []int64
+				for {
+					select {
+					case <-done:
+						sums <- seen
+						return
+					default:
+					}
+					sum, err := sumBalances(context.Background())
+					if err != nil {
+						readErr <- err
+						sums <- seen
+						return
+					}
+					seen = append(seen, sum)
+				}
+			}()
+
+			for i := 0; i < n; i++ {
+				require.NoError(t, <-errs)
+			}
+			close(done)
+			seen := <-sums
+			select {
+			case err := <-readErr:
+				require.NoError(t, err)
+			default:
+			}
+
+			require.NotEmpty(t, seen)
+			for _, sum := range seen {
+				require.Equal(t, total, sum)
+			}
+			sum, err := sumBalances(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, total, sum)
+		})
+	}
+}
+
+//BenchmarkTransferTx moves money back and forth between one hot pair of accounts from parallel goroutines
+//every transfer contends for the same two row locks, so it tracks what the locking mode costs
+func BenchmarkTransferTx(b *testing.B) {
+	for _, mode := range []LockingMode{LockingDelta, LockingSelectForUpdate} {
+		b.Run(string(mode), func(b *testing.B) {
+			store := NewStore(testDB, nil, WithLockingMode(mode))
+			account1 := createFundedAccount(b, 1_000_000_000)
+			account2 := createFundedAccount(b, 1_000_000_000)
+
+			var count atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					//alternate the direction, so neither account runs dry however long the benchmark runs
+					fromAccountID, toAccountID := account1.ID, account2.ID
+					if count.Add(1)%2 == 0 {
+						fromAccountID, toAccountID = toAccountID, fromAccountID
+					}
+					_, err := store.TransferTx(context.Background(), TransferTxParams{
+						FromAccountID: fromAccountID,
+						ToAccountID: toAccountID,
+						Amount: 1,
+					})
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "transfers/s")
+		})
+	}
+}
+
+func TestTransferTxClientID(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1 := createFundedAccount(t, 100)
 	account2 := createRandomAccount(t)
-	fmt.Println(">> Before:", account1.Balance, account2.Balance)
 
-	//run n concurrent transfer transactions
-	n := 10
-	amount := int64(10)
-	errs := make(chan error)
+	var clientID pgtype.UUID
+	_, err := rand.Read(clientID.Bytes[:])
+	require.NoError(t, err)
+	clientID.Valid = true
+	arg := TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		ClientID: clientID,
+	}
 
-	for i := 0; i < n; i++ {
-		fromAccountID := account1.ID
-		toAccountID := account2.ID
+	//concurrent retries with the same client id move the money once
+	n := 5
+	results := make(chan TransferTxResult, n)
+	errs := make(chan error, n)
+	for range n {
+		go func() {
+			result, err := store.TransferTx(context.Background(), arg)
+			errs <- err
+			results <- result
+		}()
+	}
 
-		if i % 2 == 1 {
-			fromAccountID = account2.ID
-			toAccountID = account1.ID
+	replayed := 0
+	var transferID int64
+	for range n {
+		require.NoError(t, <-errs)
+		result := <-results
+		if result.Replayed {
+			replayed++
+			require.Empty(t, result.FromEntry)
 		}
-		go func() {
-			ctx := context.Background()
+		if transferID == 0 {
+			transferID = result.Transfer.ID
+		}
+		require.Equal(t, transferID, result.Transfer.ID)
+		require.Equal(t, clientID, result.Transfer.ClientID)
+	}
+	require.Equal(t, n-1, replayed)
+
+	account1, err = testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(90), account1.Balance)
+
+	arg.Amount = 20
+	_, err = store.TransferTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrClientIDReused)
+}
+
+func TestTransferTxExternalReference(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1 := createFundedAccount(t, 100)
+	account2 := createFundedAccount(t, 100)
+
+	arg := TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		ExternalReference: pgtype.Text{String: util.RandomString(12), Valid: true},
+	}
+	first, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, first.Replayed)
+	require.Equal(t, arg.ExternalReference, first.Transfer.ExternalReference)
+
+	//the unique constraint turns the retry into a replay
+	second, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, second.Replayed)
+	require.Equal(t, first.Transfer.ID, second.Transfer.ID)
+	require.Equal(t, int64(90), second.FromAccount.Balance)
+
+	arg.Amount = 20
+	_, err = store.TransferTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrExternalReferenceReused)
+
+	//the reference is only unique per sending account
+	third, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID: account1.ID,
+		Amount: 10,
+		ExternalReference: arg.ExternalReference,
+	})
+	require.NoError(t, err)
+	require.False(t, third.Replayed)
+}
+
+func TestTransferTxMinimumAmount(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1 := createFundedAccount(t, 100)
+	account2 := createRandomAccount(t)
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 9,
+		MinimumAmount: 10,
+	})
+	require.ErrorIs(t, err, ErrAmountBelowMinimum)
+
+	//nothing was written
+	account1, err = testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), account1.Balance)
+}
+
+func TestTransferTxLockTimeout(t *testing.T) {
+	ctx := context.Background()
+	account1 := createFundedAccount(t, 100)
+	account2 := createFundedAccount(t, 100)
+
+	//another transaction holds the sender's row lock for the whole test
+	tx, err := testDB.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	_, err = New(tx).GetAccountForUpdate(ctx, account1.ID)
+	require.NoError(t, err)
+
+	for _, mode := range []LockingMode{LockingDelta, LockingSelectForUpdate} {
+		t.Run(string(mode), func(t *testing.T) {
+			store := NewStore(testDB, nil, WithLockingMode(mode), WithLockTimeout(100*time.Millisecond))
+
+			start := time.Now()
 			_, err := store.TransferTx(ctx, TransferTxParams{
-				FromAccountID: fromAccountID,
-				ToAccountID: toAccountID,
-				Amount: amount,
+				FromAccountID: account1.ID,
+				ToAccountID: account2.ID,
+				Amount: 10,
 			})
+			require.ErrorIs(t, err, ErrLockTimeout)
+			//well below the 30s statement timeout the test pool runs with
+			require.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
 
-			errs <- err
-		}()
+	//the failed transfers rolled back completely
+	transfers, err := testQueries.ListTransfersByAccount(ctx, ListTransfersByAccountParams{
+		AccountID: account1.ID,
+		FromTime: account1.CreatedAt,
+		ToTime: time.Now().UTC().Add(time.Minute),
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	//the timeout is local to the store's transactions, the pooled connections keep the default
+	var timeout string
+	require.NoError(t, testDB.QueryRow(ctx, "SHOW lock_timeout").Scan(&timeout))
+	require.Equal(t, "0", timeout)
+}
+
+func TestStoreReadPool(t *testing.T) {
+	account1 := createRandomAccount(t)
+
+	//without a read pool, reads fall back to the primary
+	for _, store := range []Store{NewStore(testDB, nil), NewStore(testDB, testDB)} {
+		account2, err := store.GetAccount(context.Background(), account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1, account2)
+
+		accounts, err := store.ListAccounts(context.Background(), ListAccountsParams{
+			Limit: 5,
+			Offset: 0,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, accounts)
 	}
-	//check results
-	for i := 0; i < n; i++ {
-		err := <-errs
+}
+
+func TestTransferTxWithFee(t *testing.T) {
+	store := NewStore(testDB, nil)
+
+	account1 := createFundedAccount(t, 1000)
+	account2 := createRandomAccount(t)
+	feeAccount := createRandomAccount(t)
+
+	amount := int64(200)
+	fee := TransferFee{
+		Fixed: 5,
+		BasisPoints: 100, //1%
+		AccountID: feeAccount.ID,
+	}
+	expectedFee := int64(7)
+	require.Equal(t, expectedFee, fee.Compute(amount))
+
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: amount,
+		Fee: fee,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, amount, result.Transfer.Amount)
+	require.Equal(t, expectedFee, result.Transfer.Fee)
+
+	//the sender pays amount + fee, split between the receiver and the fee account
+	require.Equal(t, -(amount + expectedFee), result.FromEntry.Amount)
+	require.Equal(t, amount, result.ToEntry.Amount)
+	require.Equal(t, feeAccount.ID, result.FeeEntry.AccountID)
+	require.Equal(t, expectedFee, result.FeeEntry.Amount)
+	require.Zero(t, result.FromEntry.Amount+result.ToEntry.Amount+result.FeeEntry.Amount)
+
+	require.Equal(t, account1.Balance-amount-expectedFee, result.FromAccount.Balance)
+	require.Equal(t, account2.Balance+amount, result.ToAccount.Balance)
+	require.Equal(t, feeAccount.Balance+expectedFee, result.FeeAccount.Balance)
+
+	updatedFeeAccount, err := testQueries.GetAccount(context.Background(), feeAccount.ID)
+	require.NoError(t, err)
+	require.Equal(t, feeAccount.Balance+expectedFee, updatedFeeAccount.Balance)
+}
+
+func TestTransferTxInsufficientBalance(t *testing.T) {
+	store := NewStore(testDB, nil)
+
+	account1 := createFundedAccount(t, 100)
+	account2 := createRandomAccount(t)
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 150,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	//the whole transaction is rolled back: balances, transfer and entries
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance, updatedAccount2.Balance)
+
+	transfers, err := testQueries.CountAccountTransfers(context.Background(), CountAccountTransfersParams{AccountID: account1.ID})
+	require.NoError(t, err)
+	require.Zero(t, transfers.Sent)
+	require.Zero(t, transfers.Received)
+
+	for _, accountID := range []int64{account1.ID, account2.ID} {
+		totals, err := testQueries.GetEntryTotals(context.Background(), GetEntryTotalsParams{AccountID: accountID})
 		require.NoError(t, err)
+		require.Zero(t, totals.TotalDeposited)
+		require.Zero(t, totals.TotalWithdrawn)
+	}
+}
+
+func TestTransferTxCurrencyChanged(t *testing.T) {
+	store := NewStore(testDB, nil)
+
+	account1 := createFundedAccount(t, 100)
+	account2, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner: util.RandomOwner(),
+		Currency: account1.Currency,
+	})
+	require.NoError(t, err)
 
+	//the currency changes after the caller checked it, but before the transfer runs
+	currency := util.USD
+	if account1.Currency == util.USD {
+		currency = util.EUR
 	}
-	//check the final update balance
-	updateAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	_, err = testQueries.UpdateAccountCurrency(context.Background(), UpdateAccountCurrencyParams{ID: account2.ID, Currency: currency})
 	require.NoError(t, err)
 
-	updateAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		Currency: account1.Currency,
+	})
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	//rolled back, nothing was credited to the relabelled account
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
 	require.NoError(t, err)
+	require.Zero(t, updatedAccount2.Balance)
+	transfers, err := testQueries.CountAccountTransfers(context.Background(), CountAccountTransfersParams{AccountID: account2.ID})
+	require.NoError(t, err)
+	require.Zero(t, transfers.Received)
+}
 
-	fmt.Println(">> After:", account1.Balance, account2.Balance)
-	require.Equal(t, account1.Balance, updateAccount1.Balance)
-	require.Equal(t, account2.Balance, updateAccount2.Balance)
-}
\ No newline at end of file
+func TestTransferTxFailedRecordsNoCompletedTransfer(t *testing.T) {
+	store := NewStore(testDB, nil)
+
+	account1 := createFundedAccount(t, 100)
+	account2 := createRandomAccount(t)
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 150,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	transfers, err := testQueries.ListTransfersByAccount(context.Background(), ListTransfersByAccountParams{
+		AccountID: account1.ID,
+		FromTime: account1.CreatedAt,
+		ToTime: time.Now().UTC().Add(time.Minute),
+		Status: NullTransferStatus{TransferStatus: TransferStatusCompleted, Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+}
+
+func TestCreateAccountTx(t *testing.T) {
+	store := NewStore(testDB, nil)
+
+	result, err := store.CreateAccountTx(context.Background(), CreateAccountTxParams{
+		Owner: util.RandomOwner(),
+		Currency: util.RandomCurrency(),
+		InitialBalance: 250,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(250), result.Account.Balance)
+	require.NotNil(t, result.OpeningEntry)
+	require.Equal(t, result.Account.ID, result.OpeningEntry.AccountID)
+	require.Equal(t, int64(250), result.OpeningEntry.Amount)
+
+	//without an initial balance there is nothing to record
+	result, err = store.CreateAccountTx(context.Background(), CreateAccountTxParams{
+		Owner: util.RandomOwner(),
+		Currency: util.RandomCurrency(),
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Account.Balance)
+	require.Nil(t, result.OpeningEntry)
+}
+
+func TestCreateAccountsTx(t *testing.T) {
+	store := NewStore(testDB, nil)
+	owner := util.RandomOwner()
+
+	results, err := store.CreateAccountsTx(context.Background(), []CreateAccountTxParams{
+		{Owner: owner, Currency: util.USD, InitialBalance: 100},
+		{Owner: owner, Currency: util.EUR},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.NotNil(t, results[0].OpeningEntry)
+	require.Nil(t, results[1].OpeningEntry)
+
+	//the duplicate rolls back the JPY account created before it
+	other := util.RandomOwner()
+	_, err = store.CreateAccountsTx(context.Background(), []CreateAccountTxParams{
+		{Owner: other, Currency: util.JPY},
+		{Owner: owner, Currency: util.USD},
+	})
+	var batchErr *AccountBatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, 1, batchErr.Index)
+	require.True(t, IsUniqueViolation(err))
+
+	accounts, err := testQueries.ListAccounts(context.Background(), ListAccountsParams{
+		Owner: pgtype.Text{String: other, Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, accounts)
+}
+
+func TestTransferTxRelaysEvent(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1 := createFundedAccount(t, 100)
+	account2 := createRandomAccount(t)
+
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+	})
+	require.NoError(t, err)
+
+	var published []Transfer
+	publish := func(event Event) error {
+		require.Equal(t, EventTransferCreated, event.EventType)
+		var transfer Transfer
+		require.NoError(t, json.Unmarshal(event.Payload, &transfer))
+		published = append(published, transfer)
+		return nil
+	}
+
+	//drain everything, earlier tests also wrote events
+	for {
+		relayed, err := store.RelayEvents(context.Background(), 100, publish)
+		require.NoError(t, err)
+		if relayed == 0 {
+			break
+		}
+	}
+	require.NotEmpty(t, published)
+	require.Equal(t, result.Transfer.ID, published[len(published)-1].ID)
+
+	//processed events are not published again
+	relayed, err := store.RelayEvents(context.Background(), 100, publish)
+	require.NoError(t, err)
+	require.Zero(t, relayed)
+}
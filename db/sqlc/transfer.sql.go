@@ -7,25 +7,103 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countAccountTransfers = `-- name: CountAccountTransfers :one
+SELECT
+  COUNT(*) FILTER (WHERE from_account_id = $1) AS sent,
+  COUNT(*) FILTER (WHERE to_account_id = $1) AS received
+FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND ($2::timestamp IS NULL OR created_at >= $2)
+  AND ($3::timestamp IS NULL OR created_at <= $3)
+`
+
+type CountAccountTransfersParams struct {
+	AccountID int64            `json:"account_id"`
+	FromTime  pgtype.Timestamp `json:"from_time"`
+	ToTime    pgtype.Timestamp `json:"to_time"`
+}
+
+type CountAccountTransfersRow struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+func (q *Queries) CountAccountTransfers(ctx context.Context, arg CountAccountTransfersParams) (CountAccountTransfersRow, error) {
+	row := q.db.QueryRow(ctx, countAccountTransfers, arg.AccountID, arg.FromTime, arg.ToTime)
+	var i CountAccountTransfersRow
+	err := row.Scan(&i.Sent, &i.Received)
+	return i, err
+}
+
+const countTransfersByAccount = `-- name: CountTransfersByAccount :one
+SELECT COUNT(*) FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND created_at BETWEEN $2 AND $3
+  AND ($4::transfer_status IS NULL OR status = $4)
+  AND ($5::varchar IS NULL OR category = $5)
+`
+
+type CountTransfersByAccountParams struct {
+	AccountID int64              `json:"account_id"`
+	FromTime  time.Time          `json:"from_time"`
+	ToTime    time.Time          `json:"to_time"`
+	Status    NullTransferStatus `json:"status"`
+	Category  pgtype.Text        `json:"category"`
+}
+
+func (q *Queries) CountTransfersByAccount(ctx context.Context, arg CountTransfersByAccountParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countTransfersByAccount,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Status,
+		arg.Category,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createTransfer = `-- name: CreateTransfer :one
 INSERT INTO transfers (
-  from_account_id, to_account_id, amount
+  from_account_id, to_account_id, amount, description, fee, status, client_id, category, external_reference
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
-RETURNING id, from_account_id, to_account_id, amount, created_at
+ON CONFLICT DO NOTHING
+RETURNING id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference
 `
 
 type CreateTransferParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Amount        int64 `json:"amount"`
+	FromAccountID     int64          `json:"from_account_id"`
+	ToAccountID       int64          `json:"to_account_id"`
+	Amount            int64          `json:"amount"`
+	Description       pgtype.Text    `json:"description"`
+	Fee               int64          `json:"fee"`
+	Status            TransferStatus `json:"status"`
+	ClientID          pgtype.UUID    `json:"client_id"`
+	Category          pgtype.Text    `json:"category"`
+	ExternalReference pgtype.Text    `json:"external_reference"`
 }
 
+// no target, so a taken client id and a taken external reference both return no row
 func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, createTransfer, arg.FromAccountID, arg.ToAccountID, arg.Amount)
+	row := q.db.QueryRow(ctx, createTransfer,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.Description,
+		arg.Fee,
+		arg.Status,
+		arg.ClientID,
+		arg.Category,
+		arg.ExternalReference,
+	)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -33,17 +111,102 @@ func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams)
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
+	)
+	return i, err
+}
+
+const getLastTransferByAccount = `-- name: GetLastTransferByAccount :one
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
+WHERE from_account_id = $1 OR to_account_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLastTransferByAccount(ctx context.Context, accountID int64) (Transfer, error) {
+	row := q.db.QueryRow(ctx, getLastTransferByAccount, accountID)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
 	)
 	return i, err
 }
 
 const getTransfer = `-- name: GetTransfer :one
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, getTransfer, id)
+	row := q.db.QueryRow(ctx, getTransfer, id)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
+	)
+	return i, err
+}
+
+const getTransferByClientID = `-- name: GetTransferByClientID :one
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
+WHERE client_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetTransferByClientID(ctx context.Context, clientID pgtype.UUID) (Transfer, error) {
+	row := q.db.QueryRow(ctx, getTransferByClientID, clientID)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
+	)
+	return i, err
+}
+
+const getTransferByExternalReference = `-- name: GetTransferByExternalReference :one
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
+WHERE from_account_id = $1 AND external_reference = $2 LIMIT 1
+`
+
+type GetTransferByExternalReferenceParams struct {
+	FromAccountID     int64       `json:"from_account_id"`
+	ExternalReference pgtype.Text `json:"external_reference"`
+}
+
+func (q *Queries) GetTransferByExternalReference(ctx context.Context, arg GetTransferByExternalReferenceParams) (Transfer, error) {
+	row := q.db.QueryRow(ctx, getTransferByExternalReference, arg.FromAccountID, arg.ExternalReference)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -51,12 +214,231 @@ func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
+	)
+	return i, err
+}
+
+const getTransferWithAccounts = `-- name: GetTransferWithAccounts :one
+SELECT
+  transfers.id, transfers.from_account_id, transfers.to_account_id, transfers.amount, transfers.created_at, transfers.description, transfers.fee, transfers.status, transfers.client_id, transfers.category, transfers.external_reference,
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE transfers.id = $1 LIMIT 1
+`
+
+type GetTransferWithAccountsRow struct {
+	Transfer     Transfer `json:"transfer"`
+	FromOwner    string   `json:"from_owner"`
+	FromCurrency string   `json:"from_currency"`
+	ToOwner      string   `json:"to_owner"`
+	ToCurrency   string   `json:"to_currency"`
+}
+
+func (q *Queries) GetTransferWithAccounts(ctx context.Context, id int64) (GetTransferWithAccountsRow, error) {
+	row := q.db.QueryRow(ctx, getTransferWithAccounts, id)
+	var i GetTransferWithAccountsRow
+	err := row.Scan(
+		&i.Transfer.ID,
+		&i.Transfer.FromAccountID,
+		&i.Transfer.ToAccountID,
+		&i.Transfer.Amount,
+		&i.Transfer.CreatedAt,
+		&i.Transfer.Description,
+		&i.Transfer.Fee,
+		&i.Transfer.Status,
+		&i.Transfer.ClientID,
+		&i.Transfer.Category,
+		&i.Transfer.ExternalReference,
+		&i.FromOwner,
+		&i.FromCurrency,
+		&i.ToOwner,
+		&i.ToCurrency,
 	)
 	return i, err
 }
 
+const listStatementLines = `-- name: ListStatementLines :many
+SELECT
+  'transfer'::varchar AS kind,
+  transfers.id AS transfer_id,
+  0::bigint AS entry_id,
+  transfers.created_at,
+  (CASE WHEN transfers.from_account_id = $1 THEN -(transfers.amount + transfers.fee) ELSE transfers.amount END)::bigint AS amount,
+  transfers.fee,
+  (CASE WHEN transfers.from_account_id = $1 THEN to_account.account_number ELSE from_account.account_number END)::varchar AS counterparty_account_number,
+  COALESCE(transfers.description, '')::varchar AS description,
+  COALESCE(transfers.category, '')::varchar AS category
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = $1 OR transfers.to_account_id = $1)
+  AND transfers.status = 'completed'
+  AND transfers.created_at BETWEEN $2 AND $3
+UNION ALL
+SELECT
+  (CASE WHEN entries.transfer_id IS NULL THEN 'opening_balance' ELSE 'fee' END)::varchar AS kind,
+  COALESCE(entries.transfer_id, 0)::bigint AS transfer_id,
+  entries.id AS entry_id,
+  entries.created_at,
+  entries.amount,
+  0::bigint AS fee,
+  COALESCE(payer.account_number, '')::varchar AS counterparty_account_number,
+  ''::varchar AS description,
+  ''::varchar AS category
+FROM entries
+JOIN accounts ON accounts.id = entries.account_id
+LEFT JOIN transfers ON transfers.id = entries.transfer_id
+LEFT JOIN accounts AS payer ON payer.id = transfers.from_account_id
+WHERE entries.account_id = $1
+  AND entries.created_at BETWEEN $2 AND $3
+  AND ((entries.transfer_id IS NULL AND entries.created_at = accounts.created_at)
+    OR (transfers.from_account_id <> $1 AND transfers.to_account_id <> $1))
+ORDER BY created_at, transfer_id, entry_id
+`
+
+type ListStatementLinesParams struct {
+	AccountID int64     `json:"account_id"`
+	FromTime  time.Time `json:"from_time"`
+	ToTime    time.Time `json:"to_time"`
+}
+
+type ListStatementLinesRow struct {
+	Kind                      string    `json:"kind"`
+	TransferID                int64     `json:"transfer_id"`
+	EntryID                   int64     `json:"entry_id"`
+	CreatedAt                 time.Time `json:"created_at"`
+	Amount                    int64     `json:"amount"`
+	Fee                       int64     `json:"fee"`
+	CounterpartyAccountNumber string    `json:"counterparty_account_number"`
+	Description               string    `json:"description"`
+	Category                  string    `json:"category"`
+}
+
+// the CSV statement: every completed transfer of the account in the range, plus its opening balance
+// and the fees it collected on other accounts' transfers, oldest first
+// amount is the signed change to the account's balance, StreamStatementLines reads it without buffering
+// pending and failed transfers never moved money, so they are left out
+// the opening balance is the entry written in the account's own transaction, which shares its now(),
+// other entries without a transfer_id predate the column and are already covered by their transfer's line
+func (q *Queries) ListStatementLines(ctx context.Context, arg ListStatementLinesParams) ([]ListStatementLinesRow, error) {
+	rows, err := q.db.Query(ctx, listStatementLines, arg.AccountID, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStatementLinesRow{}
+	for rows.Next() {
+		var i ListStatementLinesRow
+		if err := rows.Scan(
+			&i.Kind,
+			&i.TransferID,
+			&i.EntryID,
+			&i.CreatedAt,
+			&i.Amount,
+			&i.Fee,
+			&i.CounterpartyAccountNumber,
+			&i.Description,
+			&i.Category,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStatementTransfers = `-- name: ListStatementTransfers :many
+SELECT
+  transfers.id, transfers.from_account_id, transfers.to_account_id, transfers.amount, transfers.created_at, transfers.description, transfers.fee, transfers.status, transfers.client_id, transfers.category, transfers.external_reference,
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = $1 OR transfers.to_account_id = $1)
+  AND transfers.created_at BETWEEN $2 AND $3
+  AND ($4::transfer_status IS NULL OR transfers.status = $4)
+  AND ($5::varchar IS NULL OR transfers.category = $5)
+ORDER BY transfers.created_at, transfers.id
+`
+
+type ListStatementTransfersParams struct {
+	AccountID int64              `json:"account_id"`
+	FromTime  time.Time          `json:"from_time"`
+	ToTime    time.Time          `json:"to_time"`
+	Status    NullTransferStatus `json:"status"`
+	Category  pgtype.Text        `json:"category"`
+}
+
+type ListStatementTransfersRow struct {
+	Transfer     Transfer `json:"transfer"`
+	FromOwner    string   `json:"from_owner"`
+	FromCurrency string   `json:"from_currency"`
+	ToOwner      string   `json:"to_owner"`
+	ToCurrency   string   `json:"to_currency"`
+}
+
+// every transfer of the account in the range with both accounts, oldest first, StreamStatementTransfers reads it without buffering
+func (q *Queries) ListStatementTransfers(ctx context.Context, arg ListStatementTransfersParams) ([]ListStatementTransfersRow, error) {
+	rows, err := q.db.Query(ctx, listStatementTransfers,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Status,
+		arg.Category,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStatementTransfersRow{}
+	for rows.Next() {
+		var i ListStatementTransfersRow
+		if err := rows.Scan(
+			&i.Transfer.ID,
+			&i.Transfer.FromAccountID,
+			&i.Transfer.ToAccountID,
+			&i.Transfer.Amount,
+			&i.Transfer.CreatedAt,
+			&i.Transfer.Description,
+			&i.Transfer.Fee,
+			&i.Transfer.Status,
+			&i.Transfer.ClientID,
+			&i.Transfer.Category,
+			&i.Transfer.ExternalReference,
+			&i.FromOwner,
+			&i.FromCurrency,
+			&i.ToOwner,
+			&i.ToCurrency,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTransfer = `-- name: ListTransfer :many
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -68,7 +450,7 @@ type ListTransferParams struct {
 }
 
 func (q *Queries) ListTransfer(ctx context.Context, arg ListTransferParams) ([]Transfer, error) {
-	rows, err := q.db.QueryContext(ctx, listTransfer, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listTransfer, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -82,14 +464,17 @@ func (q *Queries) ListTransfer(ctx context.Context, arg ListTransferParams) ([]T
 			&i.ToAccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.Description,
+			&i.Fee,
+			&i.Status,
+			&i.ClientID,
+			&i.Category,
+			&i.ExternalReference,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
@@ -97,7 +482,7 @@ func (q *Queries) ListTransfer(ctx context.Context, arg ListTransferParams) ([]T
 }
 
 const listTransferBetweenAccounts = `-- name: ListTransferBetweenAccounts :many
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
 WHERE (from_account_id = $1 AND to_account_id = $2)
    OR (from_account_id = $2 AND to_account_id = $1)
 LIMIT $3 OFFSET $4
@@ -111,7 +496,7 @@ type ListTransferBetweenAccountsParams struct {
 }
 
 func (q *Queries) ListTransferBetweenAccounts(ctx context.Context, arg ListTransferBetweenAccountsParams) ([]Transfer, error) {
-	rows, err := q.db.QueryContext(ctx, listTransferBetweenAccounts,
+	rows, err := q.db.Query(ctx, listTransferBetweenAccounts,
 		arg.FromAccountID,
 		arg.ToAccountID,
 		arg.Limit,
@@ -130,14 +515,17 @@ func (q *Queries) ListTransferBetweenAccounts(ctx context.Context, arg ListTrans
 			&i.ToAccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.Description,
+			&i.Fee,
+			&i.Status,
+			&i.ClientID,
+			&i.Category,
+			&i.ExternalReference,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
@@ -145,7 +533,7 @@ func (q *Queries) ListTransferBetweenAccounts(ctx context.Context, arg ListTrans
 }
 
 const listTransferFromAccount = `-- name: ListTransferFromAccount :many
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
 ORDER BY from_account_id = $1, to_account_id = $1
 LIMIT $2
 OFFSET $3
@@ -158,7 +546,68 @@ type ListTransferFromAccountParams struct {
 }
 
 func (q *Queries) ListTransferFromAccount(ctx context.Context, arg ListTransferFromAccountParams) ([]Transfer, error) {
-	rows, err := q.db.QueryContext(ctx, listTransferFromAccount, arg.FromAccountID, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listTransferFromAccount, arg.FromAccountID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Transfer{}
+	for rows.Next() {
+		var i Transfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Description,
+			&i.Fee,
+			&i.Status,
+			&i.ClientID,
+			&i.Category,
+			&i.ExternalReference,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTransfersByAccount = `-- name: ListTransfersByAccount :many
+SELECT id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND created_at BETWEEN $2 AND $3
+  AND ($4::transfer_status IS NULL OR status = $4)
+  AND ($5::varchar IS NULL OR category = $5)
+ORDER BY id
+LIMIT $7
+OFFSET $6
+`
+
+type ListTransfersByAccountParams struct {
+	AccountID int64              `json:"account_id"`
+	FromTime  time.Time          `json:"from_time"`
+	ToTime    time.Time          `json:"to_time"`
+	Status    NullTransferStatus `json:"status"`
+	Category  pgtype.Text        `json:"category"`
+	Offset    int32              `json:"offset"`
+	Limit     int32              `json:"limit"`
+}
+
+func (q *Queries) ListTransfersByAccount(ctx context.Context, arg ListTransfersByAccountParams) ([]Transfer, error) {
+	rows, err := q.db.Query(ctx, listTransfersByAccount,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Status,
+		arg.Category,
+		arg.Offset,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -172,16 +621,131 @@ func (q *Queries) ListTransferFromAccount(ctx context.Context, arg ListTransferF
 			&i.ToAccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.Description,
+			&i.Fee,
+			&i.Status,
+			&i.ClientID,
+			&i.Category,
+			&i.ExternalReference,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	return items, nil
+}
+
+const listTransfersWithAccounts = `-- name: ListTransfersWithAccounts :many
+SELECT
+  transfers.id, transfers.from_account_id, transfers.to_account_id, transfers.amount, transfers.created_at, transfers.description, transfers.fee, transfers.status, transfers.client_id, transfers.category, transfers.external_reference,
+  from_account.owner AS from_owner,
+  from_account.currency AS from_currency,
+  to_account.owner AS to_owner,
+  to_account.currency AS to_currency
+FROM transfers
+JOIN accounts AS from_account ON from_account.id = transfers.from_account_id
+JOIN accounts AS to_account ON to_account.id = transfers.to_account_id
+WHERE (transfers.from_account_id = $1 OR transfers.to_account_id = $1)
+  AND transfers.created_at BETWEEN $2 AND $3
+  AND ($4::transfer_status IS NULL OR transfers.status = $4)
+  AND ($5::varchar IS NULL OR transfers.category = $5)
+ORDER BY transfers.id
+LIMIT $7
+OFFSET $6
+`
+
+type ListTransfersWithAccountsParams struct {
+	AccountID int64              `json:"account_id"`
+	FromTime  time.Time          `json:"from_time"`
+	ToTime    time.Time          `json:"to_time"`
+	Status    NullTransferStatus `json:"status"`
+	Category  pgtype.Text        `json:"category"`
+	Offset    int32              `json:"offset"`
+	Limit     int32              `json:"limit"`
+}
+
+type ListTransfersWithAccountsRow struct {
+	Transfer     Transfer `json:"transfer"`
+	FromOwner    string   `json:"from_owner"`
+	FromCurrency string   `json:"from_currency"`
+	ToOwner      string   `json:"to_owner"`
+	ToCurrency   string   `json:"to_currency"`
+}
+
+func (q *Queries) ListTransfersWithAccounts(ctx context.Context, arg ListTransfersWithAccountsParams) ([]ListTransfersWithAccountsRow, error) {
+	rows, err := q.db.Query(ctx, listTransfersWithAccounts,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.Status,
+		arg.Category,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTransfersWithAccountsRow{}
+	for rows.Next() {
+		var i ListTransfersWithAccountsRow
+		if err := rows.Scan(
+			&i.Transfer.ID,
+			&i.Transfer.FromAccountID,
+			&i.Transfer.ToAccountID,
+			&i.Transfer.Amount,
+			&i.Transfer.CreatedAt,
+			&i.Transfer.Description,
+			&i.Transfer.Fee,
+			&i.Transfer.Status,
+			&i.Transfer.ClientID,
+			&i.Transfer.Category,
+			&i.Transfer.ExternalReference,
+			&i.FromOwner,
+			&i.FromCurrency,
+			&i.ToOwner,
+			&i.ToCurrency,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return items, nil
 }
+
+const updateTransferStatus = `-- name: UpdateTransferStatus :one
+UPDATE transfers
+SET status = $1
+WHERE id = $2 AND status = 'pending'
+RETURNING id, from_account_id, to_account_id, amount, created_at, description, fee, status, client_id, category, external_reference
+`
+
+type UpdateTransferStatusParams struct {
+	Status TransferStatus `json:"status"`
+	ID     int64          `json:"id"`
+}
+
+func (q *Queries) UpdateTransferStatus(ctx context.Context, arg UpdateTransferStatusParams) (Transfer, error) {
+	row := q.db.QueryRow(ctx, updateTransferStatus, arg.Status, arg.ID)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Fee,
+		&i.Status,
+		&i.ClientID,
+		&i.Category,
+		&i.ExternalReference,
+	)
+	return i, err
+}
@@ -2,10 +2,12 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,6 +19,8 @@ func createRandomTransfer(t *testing.T) Transfer {
 		FromAccountID: account1.ID,
 		ToAccountID: account2.ID,
 		Amount: util.RandomInt(1, 100),
+		Description: pgtype.Text{String: util.RandomString(12), Valid: true},
+		Status: TransferStatusCompleted,
 	}
 	transfer, err := testQueries.CreateTransfer(context.Background(), arg)
 	require.NoError(t, err)
@@ -24,6 +28,8 @@ func createRandomTransfer(t *testing.T) Transfer {
 	require.Equal(t, arg.FromAccountID, transfer.FromAccountID)
 	require.Equal(t, arg.ToAccountID, transfer.ToAccountID)
 	require.Equal(t, arg.Amount, transfer.Amount)
+	require.Equal(t, arg.Description, transfer.Description)
+	require.Equal(t, arg.Status, transfer.Status)
 	require.NotZero(t, transfer.ID)
 	require.NotZero(t, transfer.CreatedAt)
 	return transfer
@@ -33,6 +39,18 @@ func TestCreateTransfer(t *testing.T) {
 	createRandomTransfer(t);
 }
 
+func TestCreateTransferToItself(t *testing.T) {
+	account := createRandomAccount(t)
+
+	_, err := testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+		FromAccountID: account.ID,
+		ToAccountID: account.ID,
+		Amount: 10,
+		Status: TransferStatusCompleted,
+	})
+	require.True(t, IsConstraintViolation(err, TransferDistinctAccounts))
+}
+
 func TestGetTransfer(t *testing.T) {
 	transfer1 := createRandomTransfer(t)
 	transfer2, err := testQueries.GetTransfer(context.Background(), transfer1.ID)
@@ -41,10 +59,33 @@ func TestGetTransfer(t *testing.T) {
 	require.Equal(t, transfer1.FromAccountID, transfer2.FromAccountID)
 	require.Equal(t, transfer1.ToAccountID, transfer2.ToAccountID)
 	require.Equal(t, transfer1.Amount, transfer2.Amount)
+	require.Equal(t, transfer1.Description, transfer2.Description)
 	require.Equal(t, transfer1.FromAccountID, transfer2.FromAccountID)
 	require.WithinDuration(t, transfer1.CreatedAt, transfer2.CreatedAt, time.Second)
 }
 
+func TestGetLastTransferByAccount(t *testing.T) {
+	transfer1 := createRandomTransfer(t)
+	//the reply to the same pair, received by the first sender
+	transfer2, err := testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+		FromAccountID: transfer1.ToAccountID,
+		ToAccountID: transfer1.FromAccountID,
+		Amount: 1,
+		Status: TransferStatusCompleted,
+	})
+	require.NoError(t, err)
+
+	for _, accountID := range []int64{transfer1.FromAccountID, transfer1.ToAccountID} {
+		last, err := testQueries.GetLastTransferByAccount(context.Background(), accountID)
+		require.NoError(t, err)
+		require.Equal(t, transfer2.ID, last.ID)
+	}
+
+	account := createRandomAccount(t)
+	_, err = testQueries.GetLastTransferByAccount(context.Background(), account.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
 func TestListTransfer(t *testing.T) {
 	for i:=0; i<10; i++ {
 		createRandomTransfer(t)
@@ -62,4 +103,280 @@ func TestListTransfer(t *testing.T) {
 	for _, transfer := range transfers {
 		require.NotEmpty(t, transfer)
 	}
-}
\ No newline at end of file
+}
+
+func TestCountAccountTransfers(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	for _, arg := range []CreateTransferParams{
+		{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Status: TransferStatusCompleted},
+		{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Status: TransferStatusCompleted},
+		{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 10, Status: TransferStatusCompleted},
+	} {
+		_, err := testQueries.CreateTransfer(context.Background(), arg)
+		require.NoError(t, err)
+	}
+
+	counts, err := testQueries.CountAccountTransfers(context.Background(), CountAccountTransfersParams{AccountID: account1.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), counts.Sent)
+	require.Equal(t, int64(1), counts.Received)
+}
+
+func TestUpdateTransferStatus(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	transfer, err := testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		Status: TransferStatusPending,
+	})
+	require.NoError(t, err)
+	require.Equal(t, TransferStatusPending, transfer.Status)
+
+	updated, err := testQueries.UpdateTransferStatus(context.Background(), UpdateTransferStatusParams{
+		ID: transfer.ID,
+		Status: TransferStatusCompleted,
+	})
+	require.NoError(t, err)
+	require.Equal(t, TransferStatusCompleted, updated.Status)
+
+	//only pending transfers can change state
+	_, err = testQueries.UpdateTransferStatus(context.Background(), UpdateTransferStatusParams{
+		ID: transfer.ID,
+		Status: TransferStatusFailed,
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestListTransfersByAccount(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	for _, status := range []TransferStatus{TransferStatusCompleted, TransferStatusPending, TransferStatusCompleted} {
+		_, err := testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+			FromAccountID: account1.ID,
+			ToAccountID: account2.ID,
+			Amount: 10,
+			Status: status,
+		})
+		require.NoError(t, err)
+	}
+
+	from := account1.CreatedAt
+	to := time.Now().UTC().Add(time.Minute)
+
+	transfers, err := testQueries.ListTransfersByAccount(context.Background(), ListTransfersByAccountParams{
+		AccountID: account2.ID,
+		FromTime: from,
+		ToTime: to,
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 3)
+
+	//the range is inclusive and nothing was created before the accounts
+	transfers, err = testQueries.ListTransfersByAccount(context.Background(), ListTransfersByAccountParams{
+		AccountID: account2.ID,
+		FromTime: from.Add(-time.Hour),
+		ToTime: from.Add(-time.Microsecond),
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	transfers, err = testQueries.ListTransfersByAccount(context.Background(), ListTransfersByAccountParams{
+		AccountID: account1.ID,
+		FromTime: from,
+		ToTime: to,
+		Status: NullTransferStatus{TransferStatus: TransferStatusPending, Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, TransferStatusPending, transfers[0].Status)
+
+	_, err = testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		Status: TransferStatusCompleted,
+		Category: pgtype.Text{String: "groceries", Valid: true},
+	})
+	require.NoError(t, err)
+
+	transfers, err = testQueries.ListTransfersByAccount(context.Background(), ListTransfersByAccountParams{
+		AccountID: account1.ID,
+		FromTime: from,
+		ToTime: to,
+		Category: pgtype.Text{String: "groceries", Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, "groceries", transfers[0].Category.String)
+}
+
+func TestTransfersWithAccounts(t *testing.T) {
+	transfer := createRandomTransfer(t)
+
+	row, err := testQueries.GetTransferWithAccounts(context.Background(), transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, transfer, row.Transfer)
+
+	fromAccount, err := testQueries.GetAccount(context.Background(), transfer.FromAccountID)
+	require.NoError(t, err)
+	toAccount, err := testQueries.GetAccount(context.Background(), transfer.ToAccountID)
+	require.NoError(t, err)
+	require.Equal(t, fromAccount.Owner, row.FromOwner)
+	require.Equal(t, fromAccount.Currency, row.FromCurrency)
+	require.Equal(t, toAccount.Owner, row.ToOwner)
+	require.Equal(t, toAccount.Currency, row.ToCurrency)
+
+	rows, err := testQueries.ListTransfersWithAccounts(context.Background(), ListTransfersWithAccountsParams{
+		AccountID: toAccount.ID,
+		FromTime: transfer.CreatedAt,
+		ToTime: transfer.CreatedAt,
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, row, GetTransferWithAccountsRow(rows[0]))
+
+	total, err := testQueries.CountTransfersByAccount(context.Background(), CountTransfersByAccountParams{
+		AccountID: fromAccount.ID,
+		FromTime: transfer.CreatedAt,
+		ToTime: transfer.CreatedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+}
+
+func TestStreamStatementTransfers(t *testing.T) {
+	store := NewStore(testDB, nil)
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	var created []Transfer
+	for range 3 {
+		transfer, err := testQueries.CreateTransfer(context.Background(), CreateTransferParams{
+			FromAccountID: account1.ID,
+			ToAccountID: account2.ID,
+			Amount: 10,
+			Status: TransferStatusCompleted,
+		})
+		require.NoError(t, err)
+		created = append(created, transfer)
+	}
+	arg := ListStatementTransfersParams{
+		AccountID: account2.ID,
+		FromTime: account1.CreatedAt,
+		ToTime: time.Now().UTC().Add(time.Minute),
+	}
+
+	var streamed []Transfer
+	err := store.StreamStatementTransfers(context.Background(), arg, func(row ListStatementTransfersRow) error {
+		require.Equal(t, account1.Owner, row.FromOwner)
+		require.Equal(t, account2.Currency, row.ToCurrency)
+		streamed = append(streamed, row.Transfer)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, created, streamed)
+
+	arg.Status = NullTransferStatus{TransferStatus: TransferStatusPending, Valid: true}
+	err = store.StreamStatementTransfers(context.Background(), arg, func(row ListStatementTransfersRow) error {
+		t.Fatalf("unexpected pending transfer %d", row.Transfer.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	arg.Status = NullTransferStatus{}
+
+	//an error from fn stops the stream
+	stop := errors.New("stop")
+	var calls int
+	err = store.StreamStatementTransfers(context.Background(), arg, func(row ListStatementTransfersRow) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
+
+func TestStreamStatementLines(t *testing.T) {
+	store := NewStore(testDB, nil)
+	ctx := context.Background()
+	newAccount := func(balance int64) Account {
+		result, err := store.CreateAccountTx(ctx, CreateAccountTxParams{
+			Owner: util.RandomOwner(),
+			Currency: util.USD,
+			InitialBalance: balance,
+		})
+		require.NoError(t, err)
+		return result.Account
+	}
+	account1 := newAccount(100)
+	account2 := newAccount(0)
+	feeAccount := newAccount(0)
+	result, err := store.TransferTx(ctx, TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		Fee: TransferFee{Fixed: 1, AccountID: feeAccount.ID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, result.Transfer.ID, result.FromEntry.TransferID.Int64)
+	require.Equal(t, result.Transfer.ID, result.FeeEntry.TransferID.Int64)
+	//a voided and a pending hold never moved money
+	voided, err := store.AuthorizeTx(ctx, AuthorizeTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 20})
+	require.NoError(t, err)
+	_, err = store.VoidTx(ctx, voided.Transfer.ID)
+	require.NoError(t, err)
+	_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30})
+	require.NoError(t, err)
+	//an entry without transfer_id that isn't the opening balance, like the ones written before the column
+	_, err = testQueries.CreateEntry(ctx, CreateEntryParams{AccountID: account1.ID, Amount: -5})
+	require.NoError(t, err)
+
+	lines := func(account Account) []ListStatementLinesRow {
+		var rows []ListStatementLinesRow
+		err := store.StreamStatementLines(ctx, ListStatementLinesParams{
+			AccountID: account.ID,
+			FromTime: account.CreatedAt,
+			ToTime: time.Now().UTC().Add(time.Minute),
+		}, func(row ListStatementLinesRow) error {
+			rows = append(rows, row)
+			return nil
+		})
+		require.NoError(t, err)
+		return rows
+	}
+
+	//the transfer's own entries, the holds and the unlinked entry are left out, the opening balance isn't
+	rows := lines(account1)
+	require.Len(t, rows, 2)
+	require.Equal(t, "opening_balance", rows[0].Kind)
+	require.Zero(t, rows[0].TransferID)
+	require.Equal(t, int64(100), rows[0].Amount)
+	require.Equal(t, "transfer", rows[1].Kind)
+	require.Equal(t, result.Transfer.ID, rows[1].TransferID)
+	require.Equal(t, int64(-11), rows[1].Amount)
+	require.Equal(t, account2.AccountNumber, rows[1].CounterpartyAccountNumber)
+
+	rows = lines(account2)
+	require.Len(t, rows, 1)
+	require.Equal(t, int64(10), rows[0].Amount)
+	require.Equal(t, account1.AccountNumber, rows[0].CounterpartyAccountNumber)
+
+	//the fee account isn't a party to the transfer, its line is the fee entry
+	rows = lines(feeAccount)
+	require.Len(t, rows, 1)
+	require.Equal(t, "fee", rows[0].Kind)
+	require.Equal(t, result.Transfer.ID, rows[0].TransferID)
+	require.Equal(t, result.FeeEntry.ID, rows[0].EntryID)
+	require.Equal(t, int64(1), rows[0].Amount)
+	require.Equal(t, account1.AccountNumber, rows[0].CounterpartyAccountNumber)
+}
@@ -0,0 +1,857 @@
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+//inRange is the optional, inclusive created_at filter of the queries
+func inRange(createdAt time.Time, from pgtype.Timestamp, to pgtype.Timestamp) bool {
+	if from.Valid && createdAt.Before(from.Time) {
+		return false
+	}
+	if to.Valid && createdAt.After(to.Time) {
+		return false
+	}
+	return true
+}
+
+//checkAccountKeys enforces the unique constraints on accounts for account, ignoring the row with its own id
+func (store *Store) checkAccountKeys(account db.Account) error {
+	for _, other := range store.accounts {
+		if other.ID == account.ID {
+			continue
+		}
+		if other.AccountNumber == account.AccountNumber {
+			return uniqueViolation(db.AccountNumberKey)
+		}
+		if other.Owner != account.Owner {
+			continue
+		}
+		if other.Currency == account.Currency {
+			return uniqueViolation(db.OwnerCurrencyKey)
+		}
+		if account.Name.Valid && other.Name == account.Name {
+			return uniqueViolation(db.OwnerNameKey)
+		}
+	}
+	return nil
+}
+
+func (store *Store) createAccount(arg db.CreateAccountParams) (db.Account, error) {
+	createdAt := now()
+	account := db.Account{
+		Owner: arg.Owner,
+		Balance: arg.Balance,
+		Currency: arg.Currency,
+		Name: arg.Name,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		//the column default, 12 random digits
+		AccountNumber: fmt.Sprintf("%012d", rand.Int64N(1_000_000_000_000)),
+		Metadata: json.RawMessage(`{}`),
+	}
+	if err := store.checkAccountKeys(account); err != nil {
+		return db.Account{}, err
+	}
+	account.ID = store.nextID()
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+func (store *Store) getAccount(id int64) (db.Account, error) {
+	account, ok := store.accounts[id]
+	if !ok {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	return account, nil
+}
+
+func (store *Store) CreateAccount(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.createAccount(arg)
+}
+
+func (store *Store) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.getAccount(id)
+}
+
+//GetAccountForUpdate is GetAccount, every call already holds the store lock
+func (store *Store) GetAccountForUpdate(ctx context.Context, id int64) (db.Account, error) {
+	return store.GetAccount(ctx, id)
+}
+
+func (store *Store) GetAccountByNumber(ctx context.Context, accountNumber string) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, account := range store.accounts {
+		if account.AccountNumber == accountNumber {
+			return account, nil
+		}
+	}
+	return db.Account{}, db.ErrRecordNotFound
+}
+
+func (store *Store) GetAccountByOwnerName(ctx context.Context, arg db.GetAccountByOwnerNameParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, account := range sorted(store.accounts) {
+		if account.Owner == arg.Owner && arg.Name.Valid && account.Name == arg.Name {
+			return account, nil
+		}
+	}
+	return db.Account{}, db.ErrRecordNotFound
+}
+
+func (store *Store) GetAccountByOwnerCurrency(ctx context.Context, arg db.GetAccountByOwnerCurrencyParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, account := range sorted(store.accounts) {
+		if account.Owner == arg.Owner && account.Currency == arg.Currency {
+			return account, nil
+		}
+	}
+	return db.Account{}, db.ErrRecordNotFound
+}
+
+func (store *Store) filterAccounts(owner pgtype.Text, currency pgtype.Text) []db.Account {
+	var accounts []db.Account
+	for _, account := range sorted(store.accounts) {
+		if owner.Valid && account.Owner != owner.String {
+			continue
+		}
+		if currency.Valid && account.Currency != currency.String {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+func (store *Store) ListAccounts(ctx context.Context, arg db.ListAccountsParams) ([]db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	accounts := store.filterAccounts(arg.Owner, arg.Currency)
+	if arg.SortBy == "created_at" {
+		sort.SliceStable(accounts, func(i, j int) bool {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		})
+	}
+	return page(accounts, arg.Limit, arg.Offset), nil
+}
+
+//ListAccountsByIDs is id = ANY(ids) AND an optional owner filter, ordered by id
+func (store *Store) ListAccountsByIDs(ctx context.Context, arg db.ListAccountsByIDsParams) ([]db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(arg.Ids))
+	for _, id := range arg.Ids {
+		wanted[id] = true
+	}
+	accounts := []db.Account{}
+	for _, account := range sorted(store.accounts) {
+		if wanted[account.ID] && (!arg.Owner.Valid || account.Owner == arg.Owner.String) {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+func (store *Store) CountAccounts(ctx context.Context, arg db.CountAccountsParams) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return int64(len(store.filterAccounts(arg.Owner, arg.Currency))), nil
+}
+
+func (store *Store) UpdateAccount(ctx context.Context, arg db.UpdateAccountParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(arg.ID)
+	if err != nil {
+		return account, err
+	}
+	account.Balance = arg.Balance
+	account.UpdatedAt = now()
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+func (store *Store) UpdateAccountName(ctx context.Context, arg db.UpdateAccountNameParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(arg.ID)
+	if err != nil {
+		return account, err
+	}
+	account.Name = arg.Name
+	if err := store.checkAccountKeys(account); err != nil {
+		return db.Account{}, err
+	}
+	account.UpdatedAt = now()
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+func (store *Store) GetAccountMetadata(ctx context.Context, id int64) (json.RawMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	return account.Metadata, nil
+}
+
+func (store *Store) SetAccountMetadata(ctx context.Context, arg db.SetAccountMetadataParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(arg.ID)
+	if err != nil {
+		return account, err
+	}
+	account.Metadata = arg.Metadata
+	account.UpdatedAt = now()
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+//UpdateAccountCurrency matches no row unless the account has a zero balance and no transfers
+func (store *Store) UpdateAccountCurrency(ctx context.Context, arg db.UpdateAccountCurrencyParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(arg.ID)
+	if err != nil {
+		return account, err
+	}
+	if account.Balance != 0 {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	for _, transfer := range store.transfers {
+		if transfer.FromAccountID == account.ID || transfer.ToAccountID == account.ID {
+			return db.Account{}, db.ErrRecordNotFound
+		}
+	}
+
+	account.Currency = arg.Currency
+	if err := store.checkAccountKeys(account); err != nil {
+		return db.Account{}, err
+	}
+	account.UpdatedAt = now()
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+func (store *Store) AddAccountBalance(ctx context.Context, arg db.AddAccountBalanceParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := store.getAccount(arg.ID); err != nil {
+		return db.Account{}, err
+	}
+	return store.addBalance(arg.ID, arg.Amount), nil
+}
+
+//AddAccountHeldBalance fails like the held_balance >= 0 check constraint would
+func (store *Store) AddAccountHeldBalance(ctx context.Context, arg db.AddAccountHeldBalanceParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, err := store.getAccount(arg.ID)
+	if err != nil {
+		return account, err
+	}
+	if account.HeldBalance+arg.Amount < 0 {
+		return db.Account{}, checkViolation("accounts_held_balance_check")
+	}
+	return store.addHeldBalance(arg.ID, arg.Amount), nil
+}
+
+//DeleteAccount fails while entries or transfers still reference the account
+func (store *Store) DeleteAccount(ctx context.Context, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, entry := range store.entries {
+		if entry.AccountID == id {
+			return foreignKeyViolation()
+		}
+	}
+	for _, transfer := range store.transfers {
+		if transfer.FromAccountID == id || transfer.ToAccountID == id {
+			return foreignKeyViolation()
+		}
+	}
+	delete(store.accounts, id)
+	//ON DELETE CASCADE
+	for key := range store.snapshots {
+		if key.accountID == id {
+			delete(store.snapshots, key)
+		}
+	}
+	return nil
+}
+
+func (store *Store) ListAccountBalanceDrift(ctx context.Context) ([]db.ListAccountBalanceDriftRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	totals := make(map[int64]int64)
+	for _, entry := range store.entries {
+		totals[entry.AccountID] += entry.Amount
+	}
+
+	rows := []db.ListAccountBalanceDriftRow{}
+	for _, account := range sorted(store.accounts) {
+		if account.Balance != totals[account.ID] {
+			rows = append(rows, db.ListAccountBalanceDriftRow{
+				ID: account.ID,
+				Balance: account.Balance,
+				EntriesTotal: totals[account.ID],
+			})
+		}
+	}
+	return rows, nil
+}
+
+func (store *Store) CreateEntry(ctx context.Context, arg db.CreateEntryParams) (db.Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.accountsExist(arg.AccountID); err != nil {
+		return db.Entry{}, err
+	}
+	return store.createEntry(arg.AccountID, arg.Amount, arg.TransferID.Int64), nil
+}
+
+func (store *Store) GetEntry(ctx context.Context, id int64) (db.Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.entries[id]
+	if !ok {
+		return db.Entry{}, db.ErrRecordNotFound
+	}
+	return entry, nil
+}
+
+func (store *Store) ListEntry(ctx context.Context, arg db.ListEntryParams) ([]db.Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return page(sorted(store.entries), arg.Limit, arg.Offset), nil
+}
+
+func (store *Store) filterEntries(accountID int64, from pgtype.Timestamp, to pgtype.Timestamp, sign pgtype.Text) []db.Entry {
+	var entries []db.Entry
+	for _, entry := range sorted(store.entries) {
+		if entry.AccountID != accountID || !inRange(entry.CreatedAt, from, to) {
+			continue
+		}
+		if sign.Valid && !(sign.String == "positive" && entry.Amount > 0 || sign.String == "negative" && entry.Amount < 0) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (store *Store) ListEntriesByAccount(ctx context.Context, arg db.ListEntriesByAccountParams) ([]db.Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entries := store.filterEntries(arg.AccountID, arg.FromTime, arg.ToTime, arg.Sign)
+	return page(entries, arg.Limit, arg.Offset), nil
+}
+
+func (store *Store) CountEntriesByAccount(ctx context.Context, arg db.CountEntriesByAccountParams) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return int64(len(store.filterEntries(arg.AccountID, arg.FromTime, arg.ToTime, arg.Sign))), nil
+}
+
+func (store *Store) GetEntryTotals(ctx context.Context, arg db.GetEntryTotalsParams) (db.GetEntryTotalsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var totals db.GetEntryTotalsRow
+	for _, entry := range store.filterEntries(arg.AccountID, arg.FromTime, arg.ToTime, pgtype.Text{}) {
+		if entry.Amount > 0 {
+			totals.TotalDeposited += entry.Amount
+		} else {
+			totals.TotalWithdrawn -= entry.Amount
+		}
+	}
+	return totals, nil
+}
+
+func (store *Store) UpdateEntry(ctx context.Context, arg db.UpdateEntryParams) (db.Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.entries[arg.ID]
+	if !ok {
+		return db.Entry{}, db.ErrRecordNotFound
+	}
+	entry.Amount = arg.Amount
+	store.entries[entry.ID] = entry
+	return entry, nil
+}
+
+func (store *Store) DeleteEntry(ctx context.Context, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.entries, id)
+	return nil
+}
+
+func (store *Store) createTransfer(arg db.CreateTransferParams) db.Transfer {
+	transfer := db.Transfer{
+		ID: store.nextID(),
+		FromAccountID: arg.FromAccountID,
+		ToAccountID: arg.ToAccountID,
+		Amount: arg.Amount,
+		CreatedAt: now(),
+		Description: arg.Description,
+		Fee: arg.Fee,
+		Status: arg.Status,
+		ClientID: arg.ClientID,
+		Category: arg.Category,
+		ExternalReference: arg.ExternalReference,
+	}
+	store.transfers[transfer.ID] = transfer
+	return transfer
+}
+
+//transferByClientID finds the transfer created with clientID, an invalid id matches nothing, like NULL
+func (store *Store) transferByClientID(clientID pgtype.UUID) (db.Transfer, bool) {
+	if !clientID.Valid {
+		return db.Transfer{}, false
+	}
+	for _, transfer := range store.transfers {
+		if transfer.ClientID == clientID {
+			return transfer, true
+		}
+	}
+	return db.Transfer{}, false
+}
+
+//transferByExternalReference finds the transfer the account sent with reference, an invalid reference matches nothing
+func (store *Store) transferByExternalReference(fromAccountID int64, reference pgtype.Text) (db.Transfer, bool) {
+	if !reference.Valid {
+		return db.Transfer{}, false
+	}
+	for _, transfer := range store.transfers {
+		if transfer.FromAccountID == fromAccountID && transfer.ExternalReference == reference {
+			return transfer, true
+		}
+	}
+	return db.Transfer{}, false
+}
+
+//updateTransferStatus only moves pending transfers, like the UPDATE's WHERE status = 'pending'
+func (store *Store) updateTransferStatus(arg db.UpdateTransferStatusParams) (db.Transfer, error) {
+	transfer, ok := store.transfers[arg.ID]
+	if !ok || transfer.Status != db.TransferStatusPending {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	transfer.Status = arg.Status
+	store.transfers[transfer.ID] = transfer
+	return transfer, nil
+}
+
+func (store *Store) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.accountsExist(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return db.Transfer{}, err
+	}
+	if err := distinctAccounts(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return db.Transfer{}, err
+	}
+	//ON CONFLICT DO NOTHING returns no row
+	if _, ok := store.transferByClientID(arg.ClientID); ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	if _, ok := store.transferByExternalReference(arg.FromAccountID, arg.ExternalReference); ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return store.createTransfer(arg), nil
+}
+
+func (store *Store) GetTransfer(ctx context.Context, id int64) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	transfer, ok := store.transfers[id]
+	if !ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return transfer, nil
+}
+
+func (store *Store) GetTransferByClientID(ctx context.Context, clientID pgtype.UUID) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	transfer, ok := store.transferByClientID(clientID)
+	if !ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return transfer, nil
+}
+
+func (store *Store) GetTransferByExternalReference(ctx context.Context, arg db.GetTransferByExternalReferenceParams) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	transfer, ok := store.transferByExternalReference(arg.FromAccountID, arg.ExternalReference)
+	if !ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return transfer, nil
+}
+
+func (store *Store) UpdateTransferStatus(ctx context.Context, arg db.UpdateTransferStatusParams) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.updateTransferStatus(arg)
+}
+
+func (store *Store) ListTransfer(ctx context.Context, arg db.ListTransferParams) ([]db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return page(sorted(store.transfers), arg.Limit, arg.Offset), nil
+}
+
+//ListTransferFromAccount keeps the query's ordering: every transfer, those not touching the account first
+func (store *Store) ListTransferFromAccount(ctx context.Context, arg db.ListTransferFromAccountParams) ([]db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	rank := func(transfer db.Transfer) int {
+		rank := 0
+		if transfer.FromAccountID == arg.FromAccountID {
+			rank += 2
+		}
+		if transfer.ToAccountID == arg.FromAccountID {
+			rank++
+		}
+		return rank
+	}
+	transfers := sorted(store.transfers)
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return rank(transfers[i]) < rank(transfers[j])
+	})
+	return page(transfers, arg.Limit, arg.Offset), nil
+}
+
+func (store *Store) ListTransferBetweenAccounts(ctx context.Context, arg db.ListTransferBetweenAccountsParams) ([]db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var transfers []db.Transfer
+	for _, transfer := range sorted(store.transfers) {
+		if transfer.FromAccountID == arg.FromAccountID && transfer.ToAccountID == arg.ToAccountID ||
+			transfer.FromAccountID == arg.ToAccountID && transfer.ToAccountID == arg.FromAccountID {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return page(transfers, arg.Limit, arg.Offset), nil
+}
+
+//filterTransfers selects the account's transfers created between from and to, inclusive
+//an invalid status or category matches any, like the NULL args of the queries
+func (store *Store) filterTransfers(accountID int64, from time.Time, to time.Time, status db.NullTransferStatus, category pgtype.Text) []db.Transfer {
+	var transfers []db.Transfer
+	for _, transfer := range sorted(store.transfers) {
+		if transfer.FromAccountID != accountID && transfer.ToAccountID != accountID {
+			continue
+		}
+		if transfer.CreatedAt.Before(from) || transfer.CreatedAt.After(to) {
+			continue
+		}
+		if status.Valid && transfer.Status != status.TransferStatus {
+			continue
+		}
+		if category.Valid && transfer.Category != category {
+			continue
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers
+}
+
+//GetLastTransferByAccount orders by created_at then id, both descending, like the query
+func (store *Store) GetLastTransferByAccount(ctx context.Context, accountID int64) (db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var last db.Transfer
+	found := false
+	for _, transfer := range store.transfers {
+		if transfer.FromAccountID != accountID && transfer.ToAccountID != accountID {
+			continue
+		}
+		if !found || transfer.CreatedAt.After(last.CreatedAt) || (transfer.CreatedAt.Equal(last.CreatedAt) && transfer.ID > last.ID) {
+			last, found = transfer, true
+		}
+	}
+	if !found {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return last, nil
+}
+
+func (store *Store) ListTransfersByAccount(ctx context.Context, arg db.ListTransfersByAccountParams) ([]db.Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return page(store.filterTransfers(arg.AccountID, arg.FromTime, arg.ToTime, arg.Status, arg.Category), arg.Limit, arg.Offset), nil
+}
+
+func (store *Store) ListStatementTransfers(ctx context.Context, arg db.ListStatementTransfersParams) ([]db.ListStatementTransfersRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	transfers := store.filterTransfers(arg.AccountID, arg.FromTime, arg.ToTime, arg.Status, arg.Category)
+	sort.SliceStable(transfers, func(i, j int) bool { return transfers[i].CreatedAt.Before(transfers[j].CreatedAt) })
+
+	rows := []db.ListStatementTransfersRow{}
+	for _, transfer := range transfers {
+		rows = append(rows, db.ListStatementTransfersRow(store.transferWithAccounts(transfer)))
+	}
+	return rows, nil
+}
+
+//ListStatementLines is the account's completed transfers, its opening balance and the fees it collected, ordered like the query
+func (store *Store) ListStatementLines(ctx context.Context, arg db.ListStatementLinesParams) ([]db.ListStatementLinesRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	rows := []db.ListStatementLinesRow{}
+	completed := db.NullTransferStatus{TransferStatus: db.TransferStatusCompleted, Valid: true}
+	for _, transfer := range store.filterTransfers(arg.AccountID, arg.FromTime, arg.ToTime, completed, pgtype.Text{}) {
+		row := db.ListStatementLinesRow{
+			Kind: "transfer",
+			TransferID: transfer.ID,
+			CreatedAt: transfer.CreatedAt,
+			Amount: transfer.Amount,
+			Fee: transfer.Fee,
+			CounterpartyAccountNumber: store.accounts[transfer.FromAccountID].AccountNumber,
+			Description: transfer.Description.String,
+			Category: transfer.Category.String,
+		}
+		if transfer.FromAccountID == arg.AccountID {
+			row.Amount = -(transfer.Amount + transfer.Fee)
+			row.CounterpartyAccountNumber = store.accounts[transfer.ToAccountID].AccountNumber
+		}
+		rows = append(rows, row)
+	}
+	for _, entry := range sorted(store.entries) {
+		if entry.AccountID != arg.AccountID || entry.CreatedAt.Before(arg.FromTime) || entry.CreatedAt.After(arg.ToTime) {
+			continue
+		}
+		row := db.ListStatementLinesRow{
+			Kind: "opening_balance",
+			EntryID: entry.ID,
+			CreatedAt: entry.CreatedAt,
+			Amount: entry.Amount,
+		}
+		if !entry.TransferID.Valid && !entry.CreatedAt.Equal(store.accounts[entry.AccountID].CreatedAt) {
+			//predates transfer_id, its transfer has a line already
+			continue
+		}
+		if entry.TransferID.Valid {
+			transfer := store.transfers[entry.TransferID.Int64]
+			if transfer.FromAccountID == arg.AccountID || transfer.ToAccountID == arg.AccountID {
+				continue
+			}
+			row.Kind = "fee"
+			row.TransferID = transfer.ID
+			row.CounterpartyAccountNumber = store.accounts[transfer.FromAccountID].AccountNumber
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Equal(rows[j].CreatedAt) {
+			return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+		}
+		if rows[i].TransferID != rows[j].TransferID {
+			return rows[i].TransferID < rows[j].TransferID
+		}
+		return rows[i].EntryID < rows[j].EntryID
+	})
+	return rows, nil
+}
+
+func (store *Store) CountTransfersByAccount(ctx context.Context, arg db.CountTransfersByAccountParams) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return int64(len(store.filterTransfers(arg.AccountID, arg.FromTime, arg.ToTime, arg.Status, arg.Category))), nil
+}
+
+func (store *Store) CountAccountTransfers(ctx context.Context, arg db.CountAccountTransfersParams) (db.CountAccountTransfersRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var counts db.CountAccountTransfersRow
+	for _, transfer := range store.transfers {
+		if !inRange(transfer.CreatedAt, arg.FromTime, arg.ToTime) {
+			continue
+		}
+		if transfer.FromAccountID == arg.AccountID {
+			counts.Sent++
+		}
+		if transfer.ToAccountID == arg.AccountID {
+			counts.Received++
+		}
+	}
+	return counts, nil
+}
+
+func (store *Store) transferWithAccounts(transfer db.Transfer) db.GetTransferWithAccountsRow {
+	fromAccount := store.accounts[transfer.FromAccountID]
+	toAccount := store.accounts[transfer.ToAccountID]
+	return db.GetTransferWithAccountsRow{
+		Transfer: transfer,
+		FromOwner: fromAccount.Owner,
+		FromCurrency: fromAccount.Currency,
+		ToOwner: toAccount.Owner,
+		ToCurrency: toAccount.Currency,
+	}
+}
+
+func (store *Store) GetTransferWithAccounts(ctx context.Context, id int64) (db.GetTransferWithAccountsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	transfer, ok := store.transfers[id]
+	if !ok {
+		return db.GetTransferWithAccountsRow{}, db.ErrRecordNotFound
+	}
+	return store.transferWithAccounts(transfer), nil
+}
+
+func (store *Store) ListTransfersWithAccounts(ctx context.Context, arg db.ListTransfersWithAccountsParams) ([]db.ListTransfersWithAccountsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	rows := []db.ListTransfersWithAccountsRow{}
+	for _, transfer := range page(store.filterTransfers(arg.AccountID, arg.FromTime, arg.ToTime, arg.Status, arg.Category), arg.Limit, arg.Offset) {
+		rows = append(rows, db.ListTransfersWithAccountsRow(store.transferWithAccounts(transfer)))
+	}
+	return rows, nil
+}
+
+func (store *Store) createEvent(arg db.CreateEventParams) db.Event {
+	event := db.Event{
+		ID: store.nextID(),
+		EventType: arg.EventType,
+		Payload: arg.Payload,
+		CreatedAt: now(),
+	}
+	store.events[event.ID] = event
+	return event
+}
+
+func (store *Store) CreateEvent(ctx context.Context, arg db.CreateEventParams) (db.Event, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.createEvent(arg), nil
+}
+
+func (store *Store) ListUnprocessedEvents(ctx context.Context, limit int32) ([]db.Event, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var events []db.Event
+	for _, event := range sorted(store.events) {
+		if !event.ProcessedAt.Valid {
+			events = append(events, event)
+		}
+	}
+	return page(events, limit, 0), nil
+}
+
+func (store *Store) MarkEventProcessed(ctx context.Context, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if event, ok := store.events[id]; ok {
+		event.ProcessedAt = pgtype.Timestamp{Time: now(), Valid: true}
+		store.events[id] = event
+	}
+	return nil
+}
+
+//CreateBalanceSnapshots snapshots every account that existed by the end of the day,
+//rolling its balance back by the entries made after the day ended, like the INSERT ... SELECT
+func (store *Store) CreateBalanceSnapshots(ctx context.Context, snapshotDate pgtype.Date) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	dayEnd := snapshotDate.Time.AddDate(0, 0, 1)
+	var created int64
+	for _, account := range store.accounts {
+		if !account.CreatedAt.Before(dayEnd) {
+			continue
+		}
+		key := snapshotKey{accountID: account.ID, date: snapshotDate.Time}
+		if _, ok := store.snapshots[key]; ok {
+			continue
+		}
+		balance := account.Balance
+		for _, entry := range store.entries {
+			if entry.AccountID == account.ID && !entry.CreatedAt.Before(dayEnd) {
+				balance -= entry.Amount
+			}
+		}
+		store.snapshots[key] = db.BalanceSnapshot{
+			AccountID: account.ID,
+			SnapshotDate: snapshotDate,
+			Balance: balance,
+			CreatedAt: now(),
+		}
+		created++
+	}
+	return created, nil
+}
+
+func (store *Store) GetBalanceSnapshotAsOf(ctx context.Context, arg db.GetBalanceSnapshotAsOfParams) (db.BalanceSnapshot, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var latest db.BalanceSnapshot
+	found := false
+	for key, snapshot := range store.snapshots {
+		if key.accountID != arg.AccountID || key.date.After(arg.AsOf.Time) {
+			continue
+		}
+		if !found || key.date.After(latest.SnapshotDate.Time) {
+			latest, found = snapshot, true
+		}
+	}
+	if !found {
+		return db.BalanceSnapshot{}, db.ErrRecordNotFound
+	}
+	return latest, nil
+}
@@ -0,0 +1,425 @@
+//Package testutil provides an in-memory db.Store for handler tests that don't need a database
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var _ db.Store = (*Store)(nil)
+
+//Store keeps accounts, entries, transfers, events and balance snapshots in maps guarded by a single mutex
+//it enforces the same constraints as the schema (unique keys, foreign keys, held_balance >= 0)
+//and the transactions succeed or fail as a whole, like SQLStore's
+type Store struct {
+	mu sync.Mutex
+	//relayMu keeps concurrent RelayEvents calls from publishing the same event twice
+	relayMu sync.Mutex
+	lastID int64
+	accounts map[int64]db.Account
+	entries map[int64]db.Entry
+	transfers map[int64]db.Transfer
+	events map[int64]db.Event
+	snapshots map[snapshotKey]db.BalanceSnapshot
+}
+
+//snapshotKey is the primary key of balance_snapshots
+type snapshotKey struct {
+	accountID int64
+	date time.Time
+}
+
+//NewStore creates an empty in-memory store
+func NewStore() *Store {
+	return &Store{
+		accounts: make(map[int64]db.Account),
+		entries: make(map[int64]db.Entry),
+		transfers: make(map[int64]db.Transfer),
+		events: make(map[int64]db.Event),
+		snapshots: make(map[snapshotKey]db.BalanceSnapshot),
+	}
+}
+
+//nextID hands out ids from one sequence, so ids never repeat across tables
+func (store *Store) nextID() int64 {
+	store.lastID++
+	return store.lastID
+}
+
+//now matches the precision of a postgres timestamp
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func uniqueViolation(constraint string) error {
+	return &pgconn.PgError{Code: db.UniqueViolation, ConstraintName: constraint}
+}
+
+func foreignKeyViolation() error {
+	return &pgconn.PgError{Code: db.ForeignKeyViolation}
+}
+
+//checkViolation is postgres' check_violation, raised by the held_balance >= 0 and transfer_distinct_accounts constraints
+func checkViolation(constraint string) error {
+	return &pgconn.PgError{Code: "23514", ConstraintName: constraint}
+}
+
+//distinctAccounts checks the transfer_distinct_accounts constraint
+func distinctAccounts(fromAccountID int64, toAccountID int64) error {
+	if fromAccountID == toAccountID {
+		return checkViolation(db.TransferDistinctAccounts)
+	}
+	return nil
+}
+
+//sorted returns the map's values ordered by id
+func sorted[T any](rows map[int64]T) []T {
+	ids := make([]int64, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	values := make([]T, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, rows[id])
+	}
+	return values
+}
+
+//page applies LIMIT and OFFSET, it never returns nil, like the generated queries
+func page[T any](rows []T, limit int32, offset int32) []T {
+	start := min(int(max(offset, 0)), len(rows))
+	end := min(start+int(max(limit, 0)), len(rows))
+	return append(make([]T, 0, end-start), rows[start:end]...)
+}
+
+//createEntry writes an entry, transferID is 0 for one no transfer wrote
+func (store *Store) createEntry(accountID int64, amount int64, transferID int64) db.Entry {
+	entry := db.Entry{
+		ID: store.nextID(),
+		AccountID: accountID,
+		Amount: amount,
+		CreatedAt: now(),
+		TransferID: pgtype.Int8{Int64: transferID, Valid: transferID != 0},
+	}
+	store.entries[entry.ID] = entry
+	return entry
+}
+
+func (store *Store) addBalance(accountID int64, amount int64) db.Account {
+	account := store.accounts[accountID]
+	account.Balance += amount
+	account.UpdatedAt = now()
+	store.accounts[accountID] = account
+	return account
+}
+
+func (store *Store) addHeldBalance(accountID int64, amount int64) db.Account {
+	account := store.accounts[accountID]
+	account.HeldBalance += amount
+	account.UpdatedAt = now()
+	store.accounts[accountID] = account
+	return account
+}
+
+//accountsExist checks the foreign keys of a transfer or entry
+func (store *Store) accountsExist(ids ...int64) error {
+	for _, id := range ids {
+		if _, ok := store.accounts[id]; !ok {
+			return foreignKeyViolation()
+		}
+	}
+	return nil
+}
+
+//TransferTx moves money like SQLStore.TransferTx, including the fee, the transfer.created event and client id replays
+//nothing is changed when it fails
+func (store *Store) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var result db.TransferTxResult
+	if arg.Amount < max(arg.MinimumAmount, 1) {
+		return result, db.ErrAmountBelowMinimum
+	}
+	fee := arg.Fee.Compute(arg.Amount)
+
+	if err := store.accountsExist(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return result, err
+	}
+	if err := distinctAccounts(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return result, err
+	}
+	if fee > 0 {
+		if err := store.accountsExist(arg.Fee.AccountID); err != nil {
+			return result, err
+		}
+	}
+	//the insert comes first in SQLStore, so a replay wins over the balance check
+	reused := db.ErrClientIDReused
+	transfer, ok := store.transferByClientID(arg.ClientID)
+	if !ok {
+		reused = db.ErrExternalReferenceReused
+		transfer, ok = store.transferByExternalReference(arg.FromAccountID, arg.ExternalReference)
+	}
+	if ok {
+		if transfer.FromAccountID != arg.FromAccountID || transfer.ToAccountID != arg.ToAccountID || transfer.Amount != arg.Amount {
+			return result, reused
+		}
+		result.Transfer = transfer
+		result.Replayed = true
+		result.FromAccount = store.accounts[transfer.FromAccountID]
+		result.ToAccount = store.accounts[transfer.ToAccountID]
+		return result, nil
+	}
+	//net balance change per account, checked before anything is written
+	deltas := map[int64]int64{arg.FromAccountID: 0, arg.ToAccountID: 0}
+	deltas[arg.FromAccountID] -= arg.Amount + fee
+	deltas[arg.ToAccountID] += arg.Amount
+	if fee > 0 {
+		deltas[arg.Fee.AccountID] += fee
+	}
+	if arg.Currency != "" {
+		for id := range deltas {
+			if account := store.accounts[id]; account.Currency != arg.Currency {
+				return result, fmt.Errorf("account [%d] %w: %s vs %s", id, db.ErrCurrencyMismatch, account.Currency, arg.Currency)
+			}
+		}
+	}
+	if store.accounts[arg.FromAccountID].AvailableBalance()+deltas[arg.FromAccountID] < 0 {
+		return result, db.ErrInsufficientBalance
+	}
+
+	result.Transfer = store.createTransfer(db.CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID: arg.ToAccountID,
+		Amount: arg.Amount,
+		Description: arg.Description,
+		Fee: fee,
+		Status: db.TransferStatusCompleted,
+		ClientID: arg.ClientID,
+		Category: arg.Category,
+		ExternalReference: arg.ExternalReference,
+	})
+	if err := store.createTransferEvent(result.Transfer); err != nil {
+		return result, err
+	}
+
+	result.FromEntry = store.createEntry(arg.FromAccountID, -(arg.Amount + fee), result.Transfer.ID)
+	result.ToEntry = store.createEntry(arg.ToAccountID, arg.Amount, result.Transfer.ID)
+	if fee > 0 {
+		result.FeeEntry = store.createEntry(arg.Fee.AccountID, fee, result.Transfer.ID)
+	}
+	for id, delta := range deltas {
+		store.addBalance(id, delta)
+	}
+	result.FromAccount = store.accounts[arg.FromAccountID]
+	result.ToAccount = store.accounts[arg.ToAccountID]
+	if fee > 0 {
+		result.FeeAccount = store.accounts[arg.Fee.AccountID]
+	}
+
+	return result, nil
+}
+
+//createTransferEvent records the completed transfer in the outbox, like db's createTransferEvent
+func (store *Store) createTransferEvent(transfer db.Transfer) error {
+	payload, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	store.createEvent(db.CreateEventParams{EventType: db.EventTransferCreated, Payload: payload})
+	return nil
+}
+
+//AuthorizeTx creates a pending transfer and holds its amount, like SQLStore.AuthorizeTx
+func (store *Store) AuthorizeTx(ctx context.Context, arg db.AuthorizeTxParams) (db.AuthorizeTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var result db.AuthorizeTxResult
+	if err := store.accountsExist(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return result, err
+	}
+	if err := distinctAccounts(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return result, err
+	}
+	if store.accounts[arg.FromAccountID].AvailableBalance()-arg.Amount < 0 {
+		return result, db.ErrInsufficientBalance
+	}
+
+	result.Transfer = store.createTransfer(db.CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID: arg.ToAccountID,
+		Amount: arg.Amount,
+		Description: arg.Description,
+		Status: db.TransferStatusPending,
+	})
+	result.FromAccount = store.addHeldBalance(arg.FromAccountID, arg.Amount)
+	return result, nil
+}
+
+//CaptureTx completes a pending transfer and writes its transfer.created event, like SQLStore.CaptureTx
+func (store *Store) CaptureTx(ctx context.Context, transferID int64) (db.TransferTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var result db.TransferTxResult
+	transfer, err := store.updateTransferStatus(db.UpdateTransferStatusParams{
+		ID: transferID,
+		Status: db.TransferStatusCompleted,
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := store.createTransferEvent(transfer); err != nil {
+		return result, err
+	}
+
+	result.Transfer = transfer
+	result.FromEntry = store.createEntry(transfer.FromAccountID, -transfer.Amount, transfer.ID)
+	result.ToEntry = store.createEntry(transfer.ToAccountID, transfer.Amount, transfer.ID)
+	store.addBalance(transfer.FromAccountID, -transfer.Amount)
+	result.ToAccount = store.addBalance(transfer.ToAccountID, transfer.Amount)
+	result.FromAccount = store.addHeldBalance(transfer.FromAccountID, -transfer.Amount)
+	return result, nil
+}
+
+//VoidTx fails a pending transfer and releases its hold, like SQLStore.VoidTx
+func (store *Store) VoidTx(ctx context.Context, transferID int64) (db.AuthorizeTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var result db.AuthorizeTxResult
+	transfer, err := store.updateTransferStatus(db.UpdateTransferStatusParams{
+		ID: transferID,
+		Status: db.TransferStatusFailed,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Transfer = transfer
+	result.FromAccount = store.addHeldBalance(transfer.FromAccountID, -transfer.Amount)
+	return result, nil
+}
+
+//CreateAccountTx creates an account and its opening entry, like SQLStore.CreateAccountTx
+func (store *Store) CreateAccountTx(ctx context.Context, arg db.CreateAccountTxParams) (db.CreateAccountTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.openAccount(arg)
+}
+
+//CreateAccountsTx creates all accounts or none, like SQLStore.CreateAccountsTx
+func (store *Store) CreateAccountsTx(ctx context.Context, args []db.CreateAccountTxParams) ([]db.CreateAccountTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	results := make([]db.CreateAccountTxResult, 0, len(args))
+	for i, arg := range args {
+		result, err := store.openAccount(arg)
+		if err != nil {
+			//roll back what the batch created so far
+			for _, created := range results {
+				delete(store.accounts, created.Account.ID)
+				if created.OpeningEntry != nil {
+					delete(store.entries, created.OpeningEntry.ID)
+				}
+			}
+			return nil, &db.AccountBatchError{Index: i, Err: err}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (store *Store) openAccount(arg db.CreateAccountTxParams) (db.CreateAccountTxResult, error) {
+	var result db.CreateAccountTxResult
+	account, err := store.createAccount(db.CreateAccountParams{
+		Owner: arg.Owner,
+		Balance: arg.InitialBalance,
+		Currency: arg.Currency,
+		Name: arg.Name,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Account = account
+	if arg.InitialBalance != 0 {
+		entry := store.createEntry(account.ID, arg.InitialBalance, 0)
+		//written in the account's transaction, so in postgres both rows get the same now()
+		entry.CreatedAt = account.CreatedAt
+		store.entries[entry.ID] = entry
+		result.OpeningEntry = &entry
+	}
+	return result, nil
+}
+
+//Ping always succeeds, there is no database to reach
+func (store *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+//StreamStatementTransfers passes the rows of ListStatementTransfers to fn, like SQLStore.StreamStatementTransfers
+func (store *Store) StreamStatementTransfers(ctx context.Context, arg db.ListStatementTransfersParams, fn func(db.ListStatementTransfersRow) error) error {
+	//fn runs without the store lock, so it may call back into the store
+	rows, err := store.ListStatementTransfers(ctx, arg)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//StreamStatementLines passes the rows of ListStatementLines to fn, like SQLStore.StreamStatementLines
+func (store *Store) StreamStatementLines(ctx context.Context, arg db.ListStatementLinesParams, fn func(db.ListStatementLinesRow) error) error {
+	rows, err := store.ListStatementLines(ctx, arg)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//RelayEvents publishes unprocessed events in id order, like SQLStore.RelayEvents
+//an error from publish leaves the whole batch unprocessed
+func (store *Store) RelayEvents(ctx context.Context, limit int32, publish func(db.Event) error) (int, error) {
+	store.relayMu.Lock()
+	defer store.relayMu.Unlock()
+
+	//publish runs without the store lock, so it may call back into the store
+	events, err := store.ListUnprocessedEvents(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if err := publish(event); err != nil {
+			return 0, err
+		}
+	}
+	for _, event := range events {
+		if err := store.MarkEventProcessed(ctx, event.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
@@ -0,0 +1,387 @@
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
+	"github.com/TriNgoc2077/Simple-Bank/util"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func createAccount(t *testing.T, store *Store, currency string, balance int64) db.Account {
+	result, err := store.CreateAccountTx(context.Background(), db.CreateAccountTxParams{
+		Owner: util.RandomOwner(),
+		Currency: currency,
+		InitialBalance: balance,
+	})
+	require.NoError(t, err)
+	return result.Account
+}
+
+func TestCreateAccountKeys(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner: "alice",
+		Currency: util.USD,
+		Name: pgtype.Text{String: "savings", Valid: true},
+	})
+	require.NoError(t, err)
+	require.NotZero(t, account.ID)
+
+	_, err = store.CreateAccount(ctx, db.CreateAccountParams{Owner: "alice", Currency: util.USD})
+	require.True(t, db.IsConstraintViolation(err, db.OwnerCurrencyKey))
+
+	_, err = store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner: "alice",
+		Currency: util.EUR,
+		Name: account.Name,
+	})
+	require.True(t, db.IsConstraintViolation(err, db.OwnerNameKey))
+
+	_, err = store.GetAccount(ctx, account.ID+100)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func TestTransferTx(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 0)
+	feeAccount := createAccount(t, store, util.USD, 0)
+
+	result, err := store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 50,
+		Fee: db.TransferFee{Fixed: 2, AccountID: feeAccount.ID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, db.TransferStatusCompleted, result.Transfer.Status)
+	require.Equal(t, int64(48), result.FromAccount.Balance)
+	require.Equal(t, int64(50), result.ToAccount.Balance)
+	require.Equal(t, int64(2), result.FeeAccount.Balance)
+	require.Equal(t, int64(-52), result.FromEntry.Amount)
+
+	drift, err := store.ListAccountBalanceDrift(ctx)
+	require.NoError(t, err)
+	require.Empty(t, drift)
+
+	var published []db.Transfer
+	relayed, err := store.RelayEvents(ctx, 10, func(event db.Event) error {
+		var transfer db.Transfer
+		require.NoError(t, json.Unmarshal(event.Payload, &transfer))
+		published = append(published, transfer)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, relayed)
+	require.Equal(t, result.Transfer.ID, published[0].ID)
+}
+
+func TestTransferTxInsufficientBalance(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 10)
+	account2 := createAccount(t, store, util.USD, 0)
+
+	_, err := store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 11,
+	})
+	require.ErrorIs(t, err, db.ErrInsufficientBalance)
+
+	//nothing was written
+	account1, err = store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), account1.Balance)
+	count, err := store.CountTransfersByAccount(ctx, db.CountTransfersByAccountParams{
+		AccountID: account1.ID,
+		FromTime: account1.CreatedAt,
+		ToTime: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	_, err = store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID + 100,
+		Amount: 1,
+	})
+	require.True(t, db.IsForeignKeyViolation(err))
+}
+
+func TestTransferTxCurrencyMismatch(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.EUR, 0)
+
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+	require.ErrorIs(t, err, db.ErrCurrencyMismatch)
+
+	account1, err = store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), account1.Balance)
+}
+
+func TestTransferTxConcurrent(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 100)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fromAccountID, toAccountID := account1.ID, account2.ID
+			if i%2 == 1 {
+				fromAccountID, toAccountID = toAccountID, fromAccountID
+			}
+			_, err := store.TransferTx(ctx, db.TransferTxParams{
+				FromAccountID: fromAccountID,
+				ToAccountID: toAccountID,
+				Amount: 10,
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	account1, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	account2, err = store.GetAccount(ctx, account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), account1.Balance)
+	require.Equal(t, int64(100), account2.Balance)
+}
+
+func TestAuthorizeCaptureVoid(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 0)
+
+	hold, err := store.AuthorizeTx(ctx, db.AuthorizeTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 60,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(40), hold.FromAccount.AvailableBalance())
+
+	_, err = store.AuthorizeTx(ctx, db.AuthorizeTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 41,
+	})
+	require.ErrorIs(t, err, db.ErrInsufficientBalance)
+
+	result, err := store.CaptureTx(ctx, hold.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(40), result.FromAccount.Balance)
+	require.Zero(t, result.FromAccount.HeldBalance)
+	require.Equal(t, int64(60), result.ToAccount.Balance)
+
+	//only the capture completes the transfer, so it's the one event in the outbox
+	var published []db.Transfer
+	relayed, err := store.RelayEvents(ctx, 10, func(event db.Event) error {
+		var transfer db.Transfer
+		require.NoError(t, json.Unmarshal(event.Payload, &transfer))
+		published = append(published, transfer)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, relayed)
+	require.Equal(t, result.Transfer.ID, published[0].ID)
+	require.Equal(t, db.TransferStatusCompleted, published[0].Status)
+
+	//a captured transfer is no longer pending
+	_, err = store.VoidTx(ctx, hold.Transfer.ID)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func TestUpdateAccountCurrencyGuard(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account := createAccount(t, store, util.USD, 10)
+
+	_, err := store.UpdateAccountCurrency(ctx, db.UpdateAccountCurrencyParams{ID: account.ID, Currency: util.EUR})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	empty := createAccount(t, store, util.USD, 0)
+	updated, err := store.UpdateAccountCurrency(ctx, db.UpdateAccountCurrencyParams{ID: empty.ID, Currency: util.EUR})
+	require.NoError(t, err)
+	require.Equal(t, util.EUR, updated.Currency)
+}
+
+func TestListAccountsPage(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	for range 3 {
+		createAccount(t, store, util.USD, 0)
+	}
+
+	accounts, err := store.ListAccounts(ctx, db.ListAccountsParams{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+
+	accounts, err = store.ListAccounts(ctx, db.ListAccountsParams{Limit: 2, Offset: 5})
+	require.NoError(t, err)
+	require.NotNil(t, accounts)
+	require.Empty(t, accounts)
+}
+
+func TestTransferTxClientID(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 0)
+
+	var clientID pgtype.UUID
+	require.NoError(t, clientID.Scan("6f1c2b3a-4d5e-4f60-8a7b-9c0d1e2f3a4b"))
+	arg := db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		ClientID: clientID,
+	}
+
+	first, err := store.TransferTx(ctx, arg)
+	require.NoError(t, err)
+	require.False(t, first.Replayed)
+
+	second, err := store.TransferTx(ctx, arg)
+	require.NoError(t, err)
+	require.True(t, second.Replayed)
+	require.Equal(t, first.Transfer, second.Transfer)
+	require.Equal(t, int64(90), second.FromAccount.Balance)
+
+	arg.Amount = 20
+	_, err = store.TransferTx(ctx, arg)
+	require.ErrorIs(t, err, db.ErrClientIDReused)
+}
+
+func TestTransferTxExternalReference(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 100)
+
+	arg := db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 10,
+		ExternalReference: pgtype.Text{String: "INV-1", Valid: true},
+	}
+
+	first, err := store.TransferTx(ctx, arg)
+	require.NoError(t, err)
+	require.False(t, first.Replayed)
+
+	second, err := store.TransferTx(ctx, arg)
+	require.NoError(t, err)
+	require.True(t, second.Replayed)
+	require.Equal(t, first.Transfer, second.Transfer)
+
+	arg.Amount = 20
+	_, err = store.TransferTx(ctx, arg)
+	require.ErrorIs(t, err, db.ErrExternalReferenceReused)
+
+	//another sender may use the same reference
+	third, err := store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID: account1.ID,
+		Amount: 10,
+		ExternalReference: arg.ExternalReference,
+	})
+	require.NoError(t, err)
+	require.False(t, third.Replayed)
+}
+
+func TestTransferTxMinimumAmount(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 0)
+
+	_, err := store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID: account2.ID,
+		Amount: 9,
+		MinimumAmount: 10,
+	})
+	require.ErrorIs(t, err, db.ErrAmountBelowMinimum)
+
+	//without a minimum, 1 minor unit is the smallest amount
+	_, err = store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID})
+	require.ErrorIs(t, err, db.ErrAmountBelowMinimum)
+}
+
+func TestCreateBalanceSnapshots(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, util.USD, 100)
+	account2 := createAccount(t, store, util.USD, 0)
+
+	//both accounts and their opening entries are from two days ago
+	twoDaysAgo := now().AddDate(0, 0, -2)
+	for _, id := range []int64{account1.ID, account2.ID} {
+		account := store.accounts[id]
+		account.CreatedAt = twoDaysAgo
+		store.accounts[id] = account
+	}
+	for id, entry := range store.entries {
+		entry.CreatedAt = twoDaysAgo
+		store.entries[id] = entry
+	}
+	//today's transfer and account come after yesterday's snapshot
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30})
+	require.NoError(t, err)
+	account3 := createAccount(t, store, util.USD, 50)
+
+	yesterday := db.SnapshotDate(time.Now())
+	created, err := store.CreateBalanceSnapshots(ctx, yesterday)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), created)
+
+	snapshot, err := store.GetBalanceSnapshotAsOf(ctx, db.GetBalanceSnapshotAsOfParams{AccountID: account1.ID, AsOf: yesterday})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), snapshot.Balance)
+	require.Equal(t, yesterday, snapshot.SnapshotDate)
+
+	//a second run of the same day is a no-op
+	created, err = store.CreateBalanceSnapshots(ctx, yesterday)
+	require.NoError(t, err)
+	require.Zero(t, created)
+
+	today := db.SnapshotDate(time.Now().AddDate(0, 0, 1))
+	created, err = store.CreateBalanceSnapshots(ctx, today)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), created)
+
+	snapshot, err = store.GetBalanceSnapshotAsOf(ctx, db.GetBalanceSnapshotAsOfParams{AccountID: account1.ID, AsOf: today})
+	require.NoError(t, err)
+	require.Equal(t, int64(70), snapshot.Balance)
+
+	//a later date falls back to the latest snapshot
+	snapshot, err = store.GetBalanceSnapshotAsOf(ctx, db.GetBalanceSnapshotAsOfParams{
+		AccountID: account2.ID,
+		AsOf: pgtype.Date{Time: today.Time.AddDate(0, 0, 7), Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(30), snapshot.Balance)
+	require.Equal(t, today, snapshot.SnapshotDate)
+
+	_, err = store.GetBalanceSnapshotAsOf(ctx, db.GetBalanceSnapshotAsOfParams{AccountID: account3.ID, AsOf: yesterday})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
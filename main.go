@@ -1,30 +1,289 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/TriNgoc2077/Simple-Bank/api"
 	db "github.com/TriNgoc2077/Simple-Bank/db/sqlc"
 	"github.com/TriNgoc2077/Simple-Bank/util"
-	_ "github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const usage = `usage: simplebank [command] [flags]
+
+commands:
+  server     run the HTTP server (default)
+  migrate    apply database migrations, see "migrate -h" for flags
+  reconcile  report accounts whose balance differs from the sum of their entries
+`
+
 func main() {
+	//lifecycle events are logged as JSON so operators can follow startup state
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	//the first argument picks the command, with no arguments the binary starts the server
+	command, args := "server", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "server", "migrate", "reconcile":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	config, err := util.LoadConfig(".")
 	if err != nil {
 		log.Fatal("cannot load config: ", err)
 	}
-	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	if err := config.Validate(); err != nil {
+		log.Fatal("invalid config: ", err)
+	}
+
+	switch command {
+	case "server":
+		runServer(config)
+	case "migrate":
+		runMigrate(config, args)
+	case "reconcile":
+		runReconcile(config)
+	}
+}
+
+//openPool connects to dbURL with the configured statement timeout and checks that the database is reachable
+func openPool(config util.Config, dbURL string) (*pgxpool.Pool, error) {
+	poolConfig, err := db.NewPoolConfig(dbURL, config.DBStatementTimeout)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+//connectDB opens the primary pool
+func connectDB(config util.Config) *pgxpool.Pool {
+	connPool, err := openPool(config, config.DatabaseURL())
 	if err != nil {
 		log.Fatal("cannot connect to db:", err)
 	}
+	slog.Info("db connected", "host", connPool.Config().ConnConfig.Host, "database", connPool.Config().ConnConfig.Database, "statement_timeout", config.DBStatementTimeout)
+	return connPool
+}
 
-	store := db.NewStore(conn)
-	server := api.NewServer(store)
+func runServer(config util.Config) {
+	connPool := connectDB(config)
 
-	err = server.Start(config.ServerAddress)
-	if err != nil {
+	//read-only queries go to the replica when one is configured
+	var readPool *pgxpool.Pool
+	if config.DBReplicaSource != "" {
+		var err error
+		readPool, err = openPool(config, config.DBReplicaSource)
+		if err != nil {
+			log.Fatal("cannot connect to db replica:", err)
+		}
+		//deferred, so it's closed once the server has drained
+		defer readPool.Close()
+		slog.Info("db replica connected", "host", readPool.Config().ConnConfig.Host, "database", readPool.Config().ConnConfig.Database)
+	}
+
+	var storeOpts []db.StoreOption
+	if config.TransferLockingMode != "" {
+		storeOpts = append(storeOpts, db.WithLockingMode(db.LockingMode(config.TransferLockingMode)))
+	}
+	if config.DBLockTimeout > 0 {
+		storeOpts = append(storeOpts, db.WithLockTimeout(config.DBLockTimeout))
+	}
+	store := db.NewStore(connPool, readPool, storeOpts...)
+
+	//on SIGINT or SIGTERM the server drains: /readyz fails first, then connections close
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	//the background loops stop with ctx, the pool is only closed once they have returned
+	var background sync.WaitGroup
+	if config.OutboxPollInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			runOutboxRelay(ctx, store, config.OutboxPollInterval)
+		}()
+	}
+	if config.BalanceSnapshots {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			runBalanceSnapshots(ctx, store)
+		}()
+	}
+	//debug mode prints every route and warning, so only development gets it
+	if config.IsDevelopment() {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	server := api.NewServer(config, store)
+	if config.MaintenanceMode {
+		slog.Warn("maintenance mode is on, only allowlisted callers are served", "allowlist", config.MaintenanceAllowlist)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		slog.Info("http listening", "address", config.ServerAddress, "tls", config.TLSEnabled(), "gin_mode", gin.Mode())
+		errs <- server.Start(config.ServerAddress)
+	}()
+	if config.MetricsAddress != "" {
+		go func() {
+			slog.Info("metrics listening", "address", config.MetricsAddress)
+			errs <- server.StartMetrics()
+		}()
+	}
+
+	select {
+	case err := <-errs:
 		log.Fatal("cannot start server:", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("http draining", "drain_delay", config.ShutdownDrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownDrainDelay+shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx, config.ShutdownDrainDelay); err != nil {
+		slog.Error("cannot shut down http server", "error", err)
+	}
+	background.Wait()
+	connPool.Close()
+	slog.Info("http stopped")
+}
+
+//shutdownTimeout is how long in-flight requests get to finish once the drain delay is over
+const shutdownTimeout = 30 * time.Second
+
+//outboxBatchSize is the most events the relay publishes per poll
+const outboxBatchSize = 100
+
+//runOutboxRelay publishes committed outbox events to the log every interval until ctx is done
+//a full batch is followed by another poll right away, so a backlog drains without waiting
+func runOutboxRelay(ctx context.Context, store db.Store, interval time.Duration) {
+	publish := func(event db.Event) error {
+		slog.Info("event published", "event_id", event.ID, "event_type", event.EventType, "payload", json.RawMessage(event.Payload))
+		return nil
+	}
+
+	for ctx.Err() == nil {
+		relayed, err := store.RelayEvents(ctx, outboxBatchSize, publish)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("cannot relay outbox events", "error", err)
+		}
+		if err != nil || relayed < outboxBatchSize {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+	}
+}
+
+//snapshotRetryDelay is how long a failed balance snapshot waits before it's tried again
+const snapshotRetryDelay = time.Minute
+
+//runBalanceSnapshots snapshots the previous day's balances at startup, then after every UTC midnight, until ctx is done
+//the startup run catches up on a day missed while the server was down, and is a no-op otherwise
+func runBalanceSnapshots(ctx context.Context, store db.Store) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		date := db.SnapshotDate(time.Now())
+		created, err := store.CreateBalanceSnapshots(ctx, date)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("cannot snapshot balances", "snapshot_date", date.Time.Format(time.DateOnly), "error", err)
+			}
+			//waiting for the next midnight would lose the day for good
+			timer.Reset(snapshotRetryDelay)
+			continue
+		}
+		slog.Info("balances snapshotted", "snapshot_date", date.Time.Format(time.DateOnly), "accounts", created)
+		timer.Reset(time.Until(db.NextSnapshot(time.Now())))
+	}
+}
+
+func runMigrate(config util.Config, args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	path := flags.String("path", "db/migration", "directory holding the migration files")
+	down := flags.Int("down", 0, "roll back this many migrations instead of migrating up")
+	flags.Parse(args)
+
+	//golang-migrate selects its pgx driver by the pgx5 scheme
+	dbURL, err := url.Parse(config.DatabaseURL())
+	if err != nil {
+		log.Fatal("cannot parse db url: ", err)
+	}
+	dbURL.Scheme = "pgx5"
+
+	migration, err := migrate.New("file://"+*path, dbURL.String())
+	if err != nil {
+		log.Fatal("cannot create migration: ", err)
+	}
+	start := time.Now()
+	if *down > 0 {
+		err = migration.Steps(-*down)
+	} else {
+		err = migration.Up()
+	}
+	if err != nil && err != migrate.ErrNoChange {
+		log.Fatal("cannot run migration: ", err)
+	}
+
+	version, dirty, _ := migration.Version()
+	slog.Info("db migrated", "version", version, "dirty", dirty, "elapsed", time.Since(start))
+}
+
+//runReconcile exits with status 1 when any account drifted, so a nightly job can alert on it
+func runReconcile(config util.Config) {
+	connPool := connectDB(config)
+
+	drift, err := db.New(connPool).ListAccountBalanceDrift(context.Background())
+	connPool.Close()
+	if err != nil {
+		log.Fatal("cannot reconcile accounts: ", err)
+	}
+
+	for _, row := range drift {
+		slog.Warn("account balance drift", "account_id", row.ID, "balance", row.Balance, "entries_total", row.EntriesTotal)
+	}
+	slog.Info("reconcile finished", "drifted_accounts", len(drift))
+	if len(drift) > 0 {
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,17 @@
+package util
+
+//AccountNumberLength is the number of digits in a public account number, see migration 000011
+const AccountNumberLength = 12
+
+//IsAccountNumber reports whether s is shaped like a public account number
+func IsAccountNumber(s string) bool {
+	if len(s) != AccountNumberLength {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,15 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAccountNumber(t *testing.T) {
+	require.True(t, IsAccountNumber("000123456789"))
+	require.False(t, IsAccountNumber("12345678901"))
+	require.False(t, IsAccountNumber("1234567890123"))
+	require.False(t, IsAccountNumber("12345678901a"))
+	require.False(t, IsAccountNumber(""))
+}
@@ -0,0 +1,24 @@
+package util
+
+import "time"
+
+//Clock is the source of the current time, so tests can pin it instead of sleeping
+type Clock interface {
+	Now() time.Time
+}
+
+//RealClock reads the system clock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+//FixedClock always returns the same time, set T to move it
+type FixedClock struct {
+	T time.Time
+}
+
+func (c *FixedClock) Now() time.Time {
+	return c.T
+}
@@ -0,0 +1,20 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedClock(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := &FixedClock{T: start}
+	require.Equal(t, start, clock.Now())
+
+	clock.T = start.Add(time.Hour)
+	require.Equal(t, start.Add(time.Hour), clock.Now())
+
+	var _ Clock = RealClock{}
+	require.WithinDuration(t, time.Now(), RealClock{}.Now(), time.Second)
+}
@@ -1,15 +1,101 @@
 package util
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
 
 //config stores all configuration of the application
 //the values are read by viper from a config file or environment variables
 type Config struct {
-	DBDriver string `mapstructure:"DB_DRIVER"`
+	//Environment is development or production, anything but development runs gin in release mode
+	Environment string `mapstructure:"ENVIRONMENT"`
+	//DBSource is a raw connection string that, when set, overrides the DB_* connection fields below
 	DBSource string `mapstructure:"DB_SOURCE"`
+	DBHost string `mapstructure:"DB_HOST"`
+	DBPort string `mapstructure:"DB_PORT"`
+	DBUser string `mapstructure:"DB_USER"`
+	DBPassword string `mapstructure:"DB_PASSWORD"`
+	DBName string `mapstructure:"DB_NAME"`
+	DBSSLMode string `mapstructure:"DB_SSLMODE"`
+	DBReplicaSource string `mapstructure:"DB_REPLICA_SOURCE"`
+	//DBStatementTimeout caps how long a single query may run, 0 disables the limit
+	DBStatementTimeout time.Duration `mapstructure:"DB_STATEMENT_TIMEOUT"`
+	//DBLockTimeout is how long a transfer waits for a locked account before failing, 0 waits up to the statement timeout
+	DBLockTimeout time.Duration `mapstructure:"DB_LOCK_TIMEOUT"`
 	ServerAddress string `mapstructure:"SERVER_ADDRESS"`
+	//MetricsAddress moves /metrics and pprof off the public API onto their own listener, empty keeps /metrics on the API
+	MetricsAddress string `mapstructure:"METRICS_ADDRESS"`
+	//DBPingThreshold is the slowest database ping /readyz still reports as ready, 0 disables the limit
+	DBPingThreshold time.Duration `mapstructure:"DB_PING_THRESHOLD"`
+	//the server serves HTTPS when both TLS files are set, and plain HTTP when neither is
+	TLSCertFile string `mapstructure:"TLS_CERT_FILE"`
+	TLSKeyFile string `mapstructure:"TLS_KEY_FILE"`
+	//TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For is believed when resolving the client IP
+	//with none set, the client IP is always the connection's remote address
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+	//MaxPageSize caps page_size on list endpoints, larger requests are clamped to it
+	MaxPageSize int32 `mapstructure:"MAX_PAGE_SIZE"`
+	//EnableTransfers turned off puts the bank in read-only mode, transfer endpoints answer 503
+	EnableTransfers bool `mapstructure:"ENABLE_TRANSFERS"`
+	//MaintenanceMode answers 503 on every route but /readyz and /metrics, e.g. while a schema change runs
+	//clients whose IP is in MaintenanceAllowlist, or who send MaintenanceBypassToken in X-Maintenance-Token, still get through
+	MaintenanceMode bool `mapstructure:"MAINTENANCE_MODE"`
+	MaintenanceAllowlist []string `mapstructure:"MAINTENANCE_ALLOWLIST"`
+	MaintenanceBypassToken string `mapstructure:"MAINTENANCE_BYPASS_TOKEN"`
+	//transfers in the fee account's currency are charged TRANSFER_FEE_FIXED plus TRANSFER_FEE_BASIS_POINTS/10000 of the amount
+	TransferFeeFixed int64 `mapstructure:"TRANSFER_FEE_FIXED"`
+	TransferFeeBasisPoints int64 `mapstructure:"TRANSFER_FEE_BASIS_POINTS"`
+	TransferFeeAccountID int64 `mapstructure:"TRANSFER_FEE_ACCOUNT_ID"`
+	//TransferLockingMode is how transfers lock account rows, "delta" (the default) or "select_for_update"
+	//it's there to compare the two on a real workload
+	TransferLockingMode string `mapstructure:"TRANSFER_LOCKING_MODE"`
+	//ShutdownDrainDelay is how long /readyz answers 503 before shutdown stops accepting connections
+	//it should cover the load balancer's health check interval, so the instance is removed first
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	//TransferMinimums sets per-currency minimum transfer amounts in minor units, as CURRENCY:AMOUNT pairs like USD:100
+	//currencies not listed accept anything from 1 minor unit up
+	TransferMinimums []string `mapstructure:"TRANSFER_MINIMUMS"`
+	//TransferCategories restricts the category of new transfers to this list, with none set any label of up to 32 characters goes
+	TransferCategories []string `mapstructure:"TRANSFER_CATEGORIES"`
+	//DefaultCurrency is used for new accounts created without a currency, but only when UseDefaultCurrency is on
+	//by default the currency stays required
+	DefaultCurrency string `mapstructure:"DEFAULT_CURRENCY"`
+	UseDefaultCurrency bool `mapstructure:"USE_DEFAULT_CURRENCY"`
+	//OutboxPollInterval is how often the server publishes pending outbox events, 0 disables the relay
+	OutboxPollInterval time.Duration `mapstructure:"OUTBOX_POLL_INTERVAL"`
+	//BalanceSnapshots makes the server record every account's end-of-day balance once a day, for historical reporting
+	//it's safe on several servers at once, a day that was already taken is skipped
+	BalanceSnapshots bool `mapstructure:"BALANCE_SNAPSHOTS"`
 }
 
+//DefaultDBStatementTimeout is used when DB_STATEMENT_TIMEOUT isn't set
+const DefaultDBStatementTimeout = 30 * time.Second
+
+//DefaultDBLockTimeout is used when DB_LOCK_TIMEOUT isn't set
+const DefaultDBLockTimeout = 2 * time.Second
+
+//DefaultDBPingThreshold is used when DB_PING_THRESHOLD isn't set
+const DefaultDBPingThreshold = time.Second
+
+//DefaultMaxPageSize is used when MAX_PAGE_SIZE isn't set
+const DefaultMaxPageSize = 100
+
+//DefaultShutdownDrainDelay is used when SHUTDOWN_DRAIN_DELAY isn't set
+const DefaultShutdownDrainDelay = 5 * time.Second
+
+//DefaultOutboxPollInterval is used when OUTBOX_POLL_INTERVAL isn't set
+const DefaultOutboxPollInterval = time.Second
+
 //loadConfig reads configuration from file or environment variables 
 func LoadConfig(path string) (config Config, err error) {
 	viper.AddConfigPath(path)
@@ -17,6 +103,13 @@ func LoadConfig(path string) (config Config, err error) {
 	viper.SetConfigType("env")
 
 	viper.AutomaticEnv()
+	viper.SetDefault("DB_STATEMENT_TIMEOUT", DefaultDBStatementTimeout)
+	viper.SetDefault("DB_LOCK_TIMEOUT", DefaultDBLockTimeout)
+	viper.SetDefault("ENABLE_TRANSFERS", true)
+	viper.SetDefault("MAX_PAGE_SIZE", DefaultMaxPageSize)
+	viper.SetDefault("DB_PING_THRESHOLD", DefaultDBPingThreshold)
+	viper.SetDefault("OUTBOX_POLL_INTERVAL", DefaultOutboxPollInterval)
+	viper.SetDefault("SHUTDOWN_DRAIN_DELAY", DefaultShutdownDrainDelay)
 
 	err = viper.ReadInConfig()
 	if err != nil {
@@ -24,4 +117,191 @@ func LoadConfig(path string) (config Config, err error) {
 	}
 	err = viper.Unmarshal(&config)
 	return
-} 
\ No newline at end of file
+} 
+
+//DatabaseURL returns DBSource if set, otherwise a postgres URL built from the DB_* fields
+//the user and password are escaped, so special characters in them are safe
+func (config Config) DatabaseURL() string {
+	if config.DBSource != "" {
+		return config.DBSource
+	}
+
+	port := config.DBPort
+	if port == "" {
+		port = "5432"
+	}
+	dsn := url.URL{
+		Scheme: "postgresql",
+		User: url.UserPassword(config.DBUser, config.DBPassword),
+		Host: net.JoinHostPort(config.DBHost, port),
+		Path: "/" + config.DBName,
+	}
+	if config.DBSSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {config.DBSSLMode}}.Encode()
+	}
+	return dsn.String()
+}
+
+//TransferMinimum returns the minimum transfer amount for currency, 1 minor unit unless TRANSFER_MINIMUMS lists it
+//Validate has already rejected malformed entries, they are skipped here
+func (config Config) TransferMinimum(currency string) int64 {
+	for _, entry := range config.TransferMinimums {
+		code, amount, err := parseTransferMinimum(entry)
+		if err == nil && code == currency {
+			return amount
+		}
+	}
+	return 1
+}
+
+//parseTransferMinimum splits a TRANSFER_MINIMUMS entry into its currency and amount
+func parseTransferMinimum(entry string) (string, int64, error) {
+	currency, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok || !IsSupportedCurrency(currency) {
+		return "", 0, fmt.Errorf("TRANSFER_MINIMUMS entry %q must be a supported CURRENCY:AMOUNT", entry)
+	}
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount < 1 {
+		return "", 0, fmt.Errorf("TRANSFER_MINIMUMS entry %q needs an amount of at least 1", entry)
+	}
+	return currency, amount, nil
+}
+
+//IsTransferCategory reports whether a new transfer may use category, an empty category is always allowed
+func (config Config) IsTransferCategory(category string) bool {
+	if category == "" || len(config.TransferCategories) == 0 {
+		return true
+	}
+	return slices.Contains(config.TransferCategories, category)
+}
+
+//IsDevelopment reports whether the server runs in the development environment
+func (config Config) IsDevelopment() bool {
+	return config.Environment == "development"
+}
+
+//TLSEnabled reports whether the server should serve HTTPS
+func (config Config) TLSEnabled() bool {
+	return config.TLSCertFile != "" && config.TLSKeyFile != ""
+}
+
+func isIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+//Validate checks the config for missing or malformed values
+//it reports every problem at once instead of stopping at the first one
+func (config Config) Validate() error {
+	var errs []error
+
+	if config.DBSource == "" {
+		if config.DBHost == "" || config.DBUser == "" || config.DBName == "" {
+			errs = append(errs, errors.New("DB_SOURCE or DB_HOST, DB_USER and DB_NAME are required"))
+		}
+		switch config.DBSSLMode {
+		case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			errs = append(errs, fmt.Errorf("DB_SSLMODE %q is not a valid sslmode", config.DBSSLMode))
+		}
+	}
+
+	switch config.Environment {
+	case "", "development", "production":
+	default:
+		errs = append(errs, fmt.Errorf("ENVIRONMENT %q must be development or production", config.Environment))
+	}
+
+	if config.DBStatementTimeout < 0 {
+		errs = append(errs, errors.New("DB_STATEMENT_TIMEOUT must not be negative"))
+	}
+
+	if config.DBLockTimeout < 0 {
+		errs = append(errs, errors.New("DB_LOCK_TIMEOUT must not be negative"))
+	}
+
+	if config.DBPingThreshold < 0 {
+		errs = append(errs, errors.New("DB_PING_THRESHOLD must not be negative"))
+	}
+
+	if config.ServerAddress == "" {
+		errs = append(errs, errors.New("SERVER_ADDRESS is required"))
+	} else if _, _, err := net.SplitHostPort(config.ServerAddress); err != nil {
+		errs = append(errs, fmt.Errorf("SERVER_ADDRESS %q is invalid: %w", config.ServerAddress, err))
+	}
+
+	if config.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(config.MetricsAddress); err != nil {
+			errs = append(errs, fmt.Errorf("METRICS_ADDRESS %q is invalid: %w", config.MetricsAddress, err))
+		} else if config.MetricsAddress == config.ServerAddress {
+			errs = append(errs, errors.New("METRICS_ADDRESS must differ from SERVER_ADDRESS"))
+		}
+	}
+
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP or CIDR", proxy))
+		}
+	}
+
+	for _, entry := range config.MaintenanceAllowlist {
+		if !isIPOrCIDR(entry) {
+			errs = append(errs, fmt.Errorf("MAINTENANCE_ALLOWLIST entry %q is not an IP or CIDR", entry))
+		}
+	}
+
+	if config.MaxPageSize < 0 {
+		errs = append(errs, errors.New("MAX_PAGE_SIZE must not be negative"))
+	}
+
+	switch config.TransferLockingMode {
+	case "", "delta", "select_for_update":
+	default:
+		errs = append(errs, fmt.Errorf("TRANSFER_LOCKING_MODE %q must be delta or select_for_update", config.TransferLockingMode))
+	}
+
+	if config.OutboxPollInterval < 0 {
+		errs = append(errs, errors.New("OUTBOX_POLL_INTERVAL must not be negative"))
+	}
+
+	if config.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+
+	for _, entry := range config.TransferMinimums {
+		if _, _, err := parseTransferMinimum(entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, category := range config.TransferCategories {
+		if category == "" || utf8.RuneCountInString(category) > 32 {
+			errs = append(errs, fmt.Errorf("TRANSFER_CATEGORIES entry %q must be 1 to 32 characters", category))
+		}
+	}
+
+	if config.DefaultCurrency != "" && !IsSupportedCurrency(config.DefaultCurrency) {
+		errs = append(errs, fmt.Errorf("DEFAULT_CURRENCY %q is not a supported currency", config.DefaultCurrency))
+	} else if config.UseDefaultCurrency && config.DefaultCurrency == "" {
+		errs = append(errs, errors.New("DEFAULT_CURRENCY is required when USE_DEFAULT_CURRENCY is set"))
+	}
+
+	if config.TransferFeeFixed < 0 {
+		errs = append(errs, errors.New("TRANSFER_FEE_FIXED must not be negative"))
+	}
+	if config.TransferFeeBasisPoints < 0 || config.TransferFeeBasisPoints > 10000 {
+		errs = append(errs, errors.New("TRANSFER_FEE_BASIS_POINTS must be between 0 and 10000"))
+	}
+	if (config.TransferFeeFixed > 0 || config.TransferFeeBasisPoints > 0) && config.TransferFeeAccountID <= 0 {
+		errs = append(errs, errors.New("TRANSFER_FEE_ACCOUNT_ID is required when a transfer fee is set"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//constants for all supported currencies
+const (
+	USD = "USD"
+	EUR = "EUR"
+	JPY = "JPY"
+)
+
+//supportedCurrencies is the single source of truth for request validation and GET /currencies
+//each currency maps to its number of decimal places, amounts are always stored in the minor unit
+var supportedCurrencies = map[string]int{
+	USD: 2,
+	EUR: 2,
+	JPY: 0,
+}
+
+//ErrInvalidAmount is returned by ParseAmount for malformed amounts or more decimals than the currency has
+var ErrInvalidAmount = errors.New("invalid amount")
+
+//IsSupportedCurrency returns true if the currency is supported
+func IsSupportedCurrency(currency string) bool {
+	_, ok := supportedCurrencies[currency]
+	return ok
+}
+
+//SupportedCurrencies returns the supported currencies in alphabetical order
+func SupportedCurrencies() []string {
+	currencies := make([]string, 0, len(supportedCurrencies))
+	for currency := range supportedCurrencies {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+//CurrencyDecimals returns the number of decimal places of a supported currency, 2 for USD and 0 for JPY
+func CurrencyDecimals(currency string) int {
+	return supportedCurrencies[currency]
+}
+
+var amountPattern = regexp.MustCompile(`^([0-9]+)(?:\.([0-9]+))?$`)
+
+//ParseAmount converts a decimal amount like "12.34" to the currency's minor unit, 1234 for USD
+//it rejects negative amounts and fractions the currency can't hold, "1.5" is fine in USD but not in JPY
+func ParseAmount(amount string, currency string) (int64, error) {
+	match := amountPattern.FindStringSubmatch(amount)
+	if match == nil {
+		return 0, fmt.Errorf("%w %q", ErrInvalidAmount, amount)
+	}
+	decimals := CurrencyDecimals(currency)
+	whole, fraction := match[1], match[2]
+	if len(fraction) > decimals {
+		return 0, fmt.Errorf("%w %q: %s allows %d decimal places", ErrInvalidAmount, amount, currency, decimals)
+	}
+
+	minor, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: %w", ErrInvalidAmount, amount, err)
+	}
+	return minor, nil
+}
+
+//FormatAmount writes an amount in the currency's minor unit as a decimal string, 1234 in USD is "12.34"
+func FormatAmount(amount int64, currency string) string {
+	decimals := CurrencyDecimals(currency)
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(absInt64(amount), 10)
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+//FormatAmountGrouped is FormatAmount with the whole part grouped in thousands, 123456 in USD is "1,234.56"
+//it's meant for display, FormatAmount stays the machine readable form ParseAmount accepts
+func FormatAmountGrouped(amount int64, currency string) string {
+	formatted := FormatAmount(amount, currency)
+	sign := ""
+	if amount < 0 {
+		sign, formatted = "-", formatted[1:]
+	}
+	whole, fraction, _ := strings.Cut(formatted, ".")
+	if fraction != "" {
+		fraction = "." + fraction
+	}
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + grouped.String() + fraction
+}
+
+//absInt64 also handles math.MinInt64, which has no positive int64 counterpart
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
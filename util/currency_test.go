@@ -0,0 +1,97 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportedCurrencies(t *testing.T) {
+	require.Equal(t, []string{EUR, JPY, USD}, SupportedCurrencies())
+
+	for _, currency := range SupportedCurrencies() {
+		require.True(t, IsSupportedCurrency(currency))
+	}
+	require.False(t, IsSupportedCurrency("GBP"))
+	require.False(t, IsSupportedCurrency("usd"))
+
+	require.Equal(t, 2, CurrencyDecimals(USD))
+	require.Equal(t, 0, CurrencyDecimals(JPY))
+}
+
+func TestParseAmount(t *testing.T) {
+	testCases := []struct {
+		amount string
+		currency string
+		want int64
+		valid bool
+	}{
+		{"12.34", USD, 1234, true},
+		{"12.3", USD, 1230, true},
+		{"12", USD, 1200, true},
+		{"0.05", EUR, 5, true},
+		{"500", JPY, 500, true},
+		{"12.345", USD, 0, false},
+		{"1.5", JPY, 0, false},
+		{"1.0", JPY, 0, false},
+		{"-1", USD, 0, false},
+		{"1.", USD, 0, false},
+		{".5", USD, 0, false},
+		{"1e3", USD, 0, false},
+		{"", USD, 0, false},
+		{"99999999999999999999", USD, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.currency+" "+tc.amount, func(t *testing.T) {
+			got, err := ParseAmount(tc.amount, tc.currency)
+			if !tc.valid {
+				require.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	require.Equal(t, "12.34", FormatAmount(1234, USD))
+	require.Equal(t, "0.05", FormatAmount(5, EUR))
+	require.Equal(t, "0.00", FormatAmount(0, USD))
+	require.Equal(t, "-1.50", FormatAmount(-150, USD))
+	require.Equal(t, "500", FormatAmount(500, JPY))
+	require.Equal(t, "-92233720368547758.08", FormatAmount(math.MinInt64, USD))
+
+	//formatting and parsing round trip
+	amount, err := ParseAmount(FormatAmount(1234, USD), USD)
+	require.NoError(t, err)
+	require.Equal(t, int64(1234), amount)
+}
+
+func TestFormatAmountGrouped(t *testing.T) {
+	testCases := []struct {
+		amount int64
+		currency string
+		want string
+	}{
+		{0, USD, "0.00"},
+		{5, EUR, "0.05"},
+		{99999, USD, "999.99"},
+		{123456, USD, "1,234.56"},
+		{-123456, EUR, "-1,234.56"},
+		{100000000, EUR, "1,000,000.00"},
+		{999, JPY, "999"},
+		{1234567, JPY, "1,234,567"},
+		{-1000, JPY, "-1,000"},
+		{math.MinInt64, USD, "-92,233,720,368,547,758.08"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s/%d", tc.currency, tc.amount), func(t *testing.T) {
+			require.Equal(t, tc.want, FormatAmountGrouped(tc.amount, tc.currency))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+//SignPayload returns the hex encoded HMAC-SHA256 of payload under secret
+func SignPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//VerifySignature reports whether signature is the SignPayload of payload under secret
+//the comparison is constant time, so it doesn't leak how much of a forged signature matched
+func VerifySignature(payload []byte, signature string, secret string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
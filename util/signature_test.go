@@ -0,0 +1,20 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := RandomString(32)
+	payload := []byte(`{"transfer_id":1,"amount":10}`)
+
+	signature := SignPayload(payload, secret)
+	require.True(t, VerifySignature(payload, signature, secret))
+
+	//a tampered body, a wrong secret or a malformed signature all fail
+	require.False(t, VerifySignature([]byte(`{"transfer_id":1,"amount":1000}`), signature, secret))
+	require.False(t, VerifySignature(payload, signature, RandomString(32)))
+	require.False(t, VerifySignature(payload, "not-hex", secret))
+}